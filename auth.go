@@ -0,0 +1,287 @@
+package nougat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	authorization = "Authorization"
+	// defaultExpiryDelta is how long before its expiry a cached token is
+	// considered expired, leaving time for the request using it to be sent.
+	defaultExpiryDelta = 10 * time.Second
+)
+
+// Token is an access token for authorizing requests.
+type Token struct {
+	// AccessToken is the token sent in the Authorization header.
+	AccessToken string
+	// TokenType is the token type, such as "Bearer". Defaults to "Bearer".
+	TokenType string
+	// Expiry is when the token expires. The zero value means the token
+	// never expires.
+	Expiry time.Time
+}
+
+// Type returns the canonical token type used in the Authorization header.
+func (t *Token) Type() string {
+	if t.TokenType == "" || strings.EqualFold(t.TokenType, "bearer") {
+		return "Bearer"
+	}
+	return t.TokenType
+}
+
+// valid reports whether the token is set and doesn't expire within delta
+// of now.
+func (t *Token) valid(now time.Time, delta time.Duration) bool {
+	if t == nil || t.AccessToken == "" {
+		return false
+	}
+	return t.Expiry.IsZero() || now.Add(delta).Before(t.Expiry)
+}
+
+// TokenSource supplies access tokens. Implementations must be safe for
+// concurrent use.
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// Auth sets the TokenSource used to authorize requests. A token is fetched
+// for each new request (see Request()) and set as the request's
+// "Authorization: Bearer <token>" header. Child Nougats created with New
+// share the TokenSource.
+func (r *Nougat) Auth(tokenSource TokenSource) *Nougat {
+	r.tokenSource = tokenSource
+	return r
+}
+
+// addToken sets the Authorization header of req from the given TokenSource.
+func addToken(ctx context.Context, req *http.Request, tokenSource TokenSource) error {
+	token, err := tokenSource.Token(ctx)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(authorization, token.Type()+" "+token.AccessToken)
+	return nil
+}
+
+/********************************** CACHED TOKENS *********************************************/
+
+// cachedTokenSource caches the tokens of a TokenSource until they are about
+// to expire. Concurrent callers share a single refresh.
+type cachedTokenSource struct {
+	source TokenSource
+	delta  time.Duration
+	now    func() time.Time
+
+	mu       sync.Mutex
+	token    *Token
+	inflight *tokenCall
+}
+
+// tokenCall is a token refresh in flight.
+type tokenCall struct {
+	done  chan struct{}
+	token *Token
+	err   error
+}
+
+// NewCachedTokenSource returns a TokenSource which caches tokens from the
+// given source and only asks it for a new token when the cached one expires
+// within expiryDelta. If expiryDelta is zero, 10 seconds is used.
+func NewCachedTokenSource(source TokenSource, expiryDelta time.Duration) TokenSource {
+	if expiryDelta <= 0 {
+		expiryDelta = defaultExpiryDelta
+	}
+	return &cachedTokenSource{source: source, delta: expiryDelta, now: time.Now}
+}
+
+// Token returns the cached token or waits for a refresh. If the refresh
+// fails because the context of the caller that started it was done, the
+// remaining callers start another refresh.
+func (s *cachedTokenSource) Token(ctx context.Context) (*Token, error) {
+	for {
+		s.mu.Lock()
+		if s.token.valid(s.now(), s.delta) {
+			token := s.token
+			s.mu.Unlock()
+			return token, nil
+		}
+		call := s.inflight
+		if call == nil {
+			call = &tokenCall{done: make(chan struct{})}
+			s.inflight = call
+			s.mu.Unlock()
+			s.refresh(ctx, call)
+			return call.token, call.err
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if call.err == nil {
+			return call.token, nil
+		}
+		if !isContextError(call.err) || ctx.Err() != nil {
+			return nil, call.err
+		}
+	}
+}
+
+// refresh fetches a token from the source and publishes it to waiters.
+func (s *cachedTokenSource) refresh(ctx context.Context, call *tokenCall) {
+	call.token, call.err = s.source.Token(ctx)
+	if call.err == nil && (call.token == nil || call.token.AccessToken == "") {
+		call.token, call.err = nil, errors.New("nougat: token source returned an empty token")
+	}
+
+	s.mu.Lock()
+	if call.err == nil {
+		s.token = call.token
+	}
+	s.inflight = nil
+	s.mu.Unlock()
+	close(call.done)
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+/********************************** CLIENT CREDENTIALS *********************************************/
+
+// ClientCredentials configures the OAuth2 client credentials grant, in which
+// a client authenticates with its id and secret using HTTP Basic
+// Authentication to obtain an access token.
+//
+// For example, M-Pesa access tokens can be obtained with
+//
+//	nougat.ClientCredentials{
+//		TokenURL:     "https://sandbox.safaricom.co.ke/oauth/v1/generate",
+//		ClientID:     consumerKey,
+//		ClientSecret: consumerSecret,
+//		Method:       "GET",
+//	}.TokenSource()
+type ClientCredentials struct {
+	// TokenURL is the token endpoint.
+	TokenURL string
+	// ClientID and ClientSecret are sent with HTTP Basic Authentication.
+	ClientID     string
+	ClientSecret string
+	// Scopes optionally requests additional permissions.
+	Scopes []string
+	// Method is the HTTP method of token requests. POST requests send the
+	// grant as a form body and GET requests as url query parameters.
+	// Defaults to "POST".
+	Method string
+	// Doer sends token requests. Defaults to http.DefaultClient.
+	Doer Doer
+	// ExpiryDelta is how long before expiry a token is refreshed.
+	// Defaults to 10 seconds.
+	ExpiryDelta time.Duration
+}
+
+// clientCredentialsParams are the url encoded token request parameters.
+type clientCredentialsParams struct {
+	GrantType string `url:"grant_type"`
+	Scope     string `url:"scope,omitempty"`
+}
+
+// tokenResponse is a token endpoint response.
+type tokenResponse struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresIn   expiresIn `json:"expires_in"`
+}
+
+// tokenErrorResponse is a failed token endpoint response. It holds both the
+// OAuth2 error fields and the fields used by M-Pesa.
+type tokenErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	ErrorCode        string `json:"errorCode"`
+	ErrorMessage     string `json:"errorMessage"`
+}
+
+func (e tokenErrorResponse) String() string {
+	var parts []string
+	for _, part := range []string{e.Error, e.ErrorDescription, e.ErrorCode, e.ErrorMessage} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ": ")
+}
+
+// expiresIn is a token lifetime in seconds, which some providers (such as
+// M-Pesa) encode as a JSON string rather than a number.
+type expiresIn int64
+
+func (e *expiresIn) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "" || s == "null" {
+		*e = 0
+		return nil
+	}
+	seconds, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("nougat: invalid expires_in %s", data)
+	}
+	*e = expiresIn(seconds)
+	return nil
+}
+
+// TokenSource returns a TokenSource which requests tokens from the token
+// endpoint and caches them until they are about to expire.
+func (c ClientCredentials) TokenSource() TokenSource {
+	return NewCachedTokenSource(clientCredentialsSource{config: c}, c.ExpiryDelta)
+}
+
+// clientCredentialsSource requests a new token from the token endpoint on
+// every call.
+type clientCredentialsSource struct {
+	config ClientCredentials
+}
+
+func (s clientCredentialsSource) Token(ctx context.Context) (*Token, error) {
+	c := s.config
+	params := clientCredentialsParams{
+		GrantType: "client_credentials",
+		Scope:     strings.Join(c.Scopes, " "),
+	}
+	Nougat := New().Doer(c.Doer).Base(c.TokenURL).SetBasicAuth(c.ClientID, c.ClientSecret)
+	if strings.EqualFold(c.Method, "GET") {
+		Nougat.Get("").QueryStruct(params)
+	} else {
+		Nougat.Post("").BodyForm(params)
+	}
+
+	success := new(tokenResponse)
+	failure := new(tokenErrorResponse)
+	start := time.Now()
+	resp, err := Nougat.ReceiveContext(ctx, success, failure)
+	if err != nil {
+		return nil, err
+	}
+	if code := resp.StatusCode; code < 200 || code > 299 {
+		return nil, fmt.Errorf("nougat: token request failed with %s: %s", resp.Status, failure)
+	}
+	if success.AccessToken == "" {
+		return nil, errors.New("nougat: token response has no access_token")
+	}
+
+	token := &Token{AccessToken: success.AccessToken, TokenType: success.TokenType}
+	if success.ExpiresIn > 0 {
+		token.Expiry = start.Add(time.Duration(success.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
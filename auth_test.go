@@ -0,0 +1,221 @@
+package nougat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// staticTokenSource returns a fixed token.
+type staticTokenSource struct {
+	token *Token
+	err   error
+}
+
+func (s staticTokenSource) Token(ctx context.Context) (*Token, error) {
+	return s.token, s.err
+}
+
+// countingTokenSource issues numbered tokens which expire after ttl.
+type countingTokenSource struct {
+	calls int32
+	ttl   time.Duration
+	now   func() time.Time
+	delay time.Duration
+}
+
+func (s *countingTokenSource) Token(ctx context.Context) (*Token, error) {
+	n := atomic.AddInt32(&s.calls, 1)
+	if s.delay > 0 {
+		time.Sleep(s.delay)
+	}
+	return &Token{AccessToken: fmt.Sprintf("token-%d", n), Expiry: s.now().Add(s.ttl)}, nil
+}
+
+func TestToken_type(t *testing.T) {
+	cases := []struct {
+		tokenType string
+		expected  string
+	}{
+		{"", "Bearer"},
+		{"bearer", "Bearer"},
+		{"Bearer", "Bearer"},
+		{"MAC", "MAC"},
+	}
+	for _, c := range cases {
+		token := &Token{AccessToken: "abc", TokenType: c.tokenType}
+		if value := token.Type(); value != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, value)
+		}
+	}
+}
+
+func TestAuth_setsAuthorizationHeader(t *testing.T) {
+	source := staticTokenSource{token: &Token{AccessToken: "abc"}}
+	req, err := New().Auth(source).New().Get("http://a.io").Request()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if value := req.Header.Get("Authorization"); value != "Bearer abc" {
+		t.Errorf("expected %s, got %s", "Bearer abc", value)
+	}
+}
+
+func TestAuth_tokenError(t *testing.T) {
+	expectedErr := errors.New("token endpoint unavailable")
+	req, err := New().Auth(staticTokenSource{err: expectedErr}).Get("http://a.io").Request()
+	if err != expectedErr {
+		t.Errorf("expected %v, got %v", expectedErr, err)
+	}
+	if req != nil {
+		t.Errorf("expected nil Request, got %+v", req)
+	}
+}
+
+func TestCachedTokenSource_refreshesExpiredTokens(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	source := &countingTokenSource{ttl: time.Minute, now: clock}
+	cached := NewCachedTokenSource(source, 10*time.Second).(*cachedTokenSource)
+	cached.now = clock
+
+	cases := []struct {
+		advance  time.Duration
+		expected string
+	}{
+		{0, "token-1"},
+		{30 * time.Second, "token-1"},
+		// within the expiry delta of the first token
+		{25 * time.Second, "token-2"},
+		{time.Second, "token-2"},
+	}
+	for _, c := range cases {
+		now = now.Add(c.advance)
+		token, err := cached.Token(context.Background())
+		if err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		if token.AccessToken != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, token.AccessToken)
+		}
+	}
+}
+
+func TestCachedTokenSource_sharesRefresh(t *testing.T) {
+	source := &countingTokenSource{ttl: time.Hour, now: time.Now, delay: 20 * time.Millisecond}
+	cached := NewCachedTokenSource(source, 0)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := cached.Token(context.Background())
+			if err != nil || token.AccessToken != "token-1" {
+				t.Errorf("expected token-1, got %v, %v", token, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls := atomic.LoadInt32(&source.calls); calls != 1 {
+		t.Errorf("expected 1 refresh, got %d", calls)
+	}
+}
+
+func TestCachedTokenSource_emptyToken(t *testing.T) {
+	cached := NewCachedTokenSource(staticTokenSource{token: &Token{}}, 0)
+	if _, err := cached.Token(context.Background()); err == nil {
+		t.Errorf("expected an error for an empty token, got nil")
+	}
+}
+
+func TestClientCredentials_post(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	var calls int
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		assertMethod(t, "POST", r)
+		if id, secret, ok := r.BasicAuth(); !ok || id != "id" || secret != "secret" {
+			t.Errorf("expected basic auth id:secret, got %s:%s", id, secret)
+		}
+		assertPostForm(t, map[string]string{"grant_type": "client_credentials", "scope": "read write"}, r)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": "abc", "token_type": "bearer", "expires_in": 3600}`)
+	})
+	mux.HandleFunc("/resource", func(w http.ResponseWriter, r *http.Request) {
+		if value := r.Header.Get("Authorization"); value != "Bearer abc" {
+			t.Errorf("expected %s, got %s", "Bearer abc", value)
+		}
+		w.WriteHeader(204)
+	})
+
+	source := ClientCredentials{
+		TokenURL:     "http://example.com/oauth/token",
+		ClientID:     "id",
+		ClientSecret: "secret",
+		Scopes:       []string{"read", "write"},
+		Doer:         client,
+	}.TokenSource()
+
+	api := New().Client(client).Base("http://example.com/").Auth(source)
+	for i := 0; i < 3; i++ {
+		if _, err := api.New().Get("resource").Receive(nil, nil); err != nil {
+			t.Errorf("expected nil, got %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 token request, got %d", calls)
+	}
+}
+
+func TestClientCredentials_mpesa(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/oauth/v1/generate", func(w http.ResponseWriter, r *http.Request) {
+		assertMethod(t, "GET", r)
+		assertQuery(t, map[string]string{"grant_type": "client_credentials"}, r)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token": "mpesa-token", "expires_in": "3599"}`)
+	})
+
+	start := time.Now()
+	token, err := clientCredentialsSource{config: ClientCredentials{
+		TokenURL: "http://example.com/oauth/v1/generate",
+		Method:   "GET",
+		Doer:     client,
+	}}.Token(context.Background())
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if token.AccessToken != "mpesa-token" {
+		t.Errorf("expected %s, got %s", "mpesa-token", token.AccessToken)
+	}
+	if expiry := start.Add(3599 * time.Second); token.Expiry.Before(expiry) || token.Expiry.After(expiry.Add(time.Minute)) {
+		t.Errorf("expected expiry near %v, got %v", expiry, token.Expiry)
+	}
+}
+
+func TestClientCredentials_failure(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(400)
+		fmt.Fprintf(w, `{"errorCode": "400.008.01", "errorMessage": "Invalid Authentication passed"}`)
+	})
+
+	_, err := clientCredentialsSource{config: ClientCredentials{
+		TokenURL: "http://example.com/oauth/token",
+		Doer:     client,
+	}}.Token(context.Background())
+	expected := "nougat: token request failed with 400 Bad Request: 400.008.01: Invalid Authentication passed"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %s, got %v", expected, err)
+	}
+}
@@ -3,6 +3,7 @@ package nougat
 import (
 	"bytes"
 	"encoding/json"
+	"encoding/xml"
 	"io"
 	"strings"
 
@@ -12,6 +13,7 @@ import (
 const (
 	jsonContentType = "application/json"
 	formContentType = "application/x-www-form-urlencoded"
+	xmlContentType  = "application/xml"
 )
 
 type (
@@ -24,6 +26,19 @@ type (
 		Body() (io.Reader, error)
 	}
 
+	// ReplayableBodyProvider is a BodyProvider which may declare that each
+	// call to Body returns a new reader over the same content. Request sets
+	// the http.Request GetBody of replayable bodies, so that they can be
+	// resent on redirects and retries.
+	// The built-in JSON, form, XML, SOAP and multipart body providers are
+	// replayable, except for a Multipart with File parts.
+	ReplayableBodyProvider interface {
+		BodyProvider
+
+		// Replayable reports whether Body can be called repeatedly.
+		Replayable() bool
+	}
+
 	// bodyProvider provides the wrapped body value as a Body for requests.
 	bodyProvider struct {
 		body io.Reader
@@ -40,6 +55,12 @@ type (
 	formBodyProvider struct {
 		payload interface{}
 	}
+
+	// xmlBodyProvider encodes an XML tagged struct value as a Body for requests.
+	// See https://golang.org/pkg/encoding/xml/#Marshal for details.
+	xmlBodyProvider struct {
+		payload interface{}
+	}
 )
 
 // Body
@@ -56,16 +77,20 @@ func (p bodyProvider) Body() (io.Reader, error) {
 // Body sets the Nougat's body.
 // The body value will be set as the Body on new requests (see Request()).
 // If the provided body is also an io.Closer, the request Body will be closed by http.Client methods.
+// A nil body leaves the body unchanged and records an error (see Err()).
 func (r *Nougat) Body(body io.Reader) *Nougat {
 	if body == nil {
+		r.setErr("Body", errNilBody)
 		return r
 	}
 	return r.BodyProvider(bodyProvider{body: body})
 }
 
 // BodyProvider sets the Nougat's body provider.
+// A nil body provider leaves the body unchanged and records an error (see Err()).
 func (r *Nougat) BodyProvider(body BodyProvider) *Nougat {
 	if body == nil {
+		r.setErr("BodyProvider", errNilBody)
 		return r
 	}
 	r.bodyProvider = body
@@ -84,6 +109,10 @@ func (p jsonBodyProvider) ContentType() string {
 	return jsonContentType
 }
 
+func (p jsonBodyProvider) Replayable() bool {
+	return true
+}
+
 func (p jsonBodyProvider) Body() (io.Reader, error) {
 	buf := &bytes.Buffer{}
 
@@ -97,9 +126,11 @@ func (p jsonBodyProvider) Body() (io.Reader, error) {
 // BodyJSON sets the Nougat's bodyJSON.
 // The value pointed to by the bodyJSON will be JSON encoded as the Body on new requests (see Request()).
 // The bodyJSON argument should be a pointer to a JSON tagged struct.
+// A nil bodyJSON leaves the body unchanged and records an error (see Err()).
 // See https://golang.org/pkg/encoding/json/#MarshalIndent for details.
 func (r *Nougat) BodyJSON(bodyJSON interface{}) *Nougat {
 	if bodyJSON == nil {
+		r.setErr("BodyJSON", errNilBody)
 		return r
 	}
 	return r.BodyProvider(jsonBodyProvider{payload: bodyJSON})
@@ -110,6 +141,10 @@ func (p formBodyProvider) ContentType() string {
 	return formContentType
 }
 
+func (p formBodyProvider) Replayable() bool {
+	return true
+}
+
 func (p formBodyProvider) Body() (io.Reader, error) {
 	values, err := query.Values(p.payload)
 	if err != nil {
@@ -121,10 +156,46 @@ func (p formBodyProvider) Body() (io.Reader, error) {
 // BodyForm sets the Nougat's bodyForm.
 // The value pointed to by the bodyForm will be url encoded as the Body on new requests (see Request()).
 // The bodyForm argument should be a pointer to a url tagged struct.
+// A nil bodyForm leaves the body unchanged and records an error (see Err()).
 // See https://godoc.org/github.com/google/go-querystring/query for details.
 func (r *Nougat) BodyForm(bodyForm interface{}) *Nougat {
 	if bodyForm == nil {
+		r.setErr("BodyForm", errNilBody)
 		return r
 	}
 	return r.BodyProvider(formBodyProvider{payload: bodyForm})
 }
+
+/********************************** XML BODY *********************************************/
+
+func (p xmlBodyProvider) ContentType() string {
+	return xmlContentType
+}
+
+func (p xmlBodyProvider) Replayable() bool {
+	return true
+}
+
+func (p xmlBodyProvider) Body() (io.Reader, error) {
+	buf := bytes.NewBufferString(xml.Header)
+
+	err := xml.NewEncoder(buf).Encode(p.payload)
+	if err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// BodyXML sets the Nougat's bodyXML.
+// The value pointed to by the bodyXML will be XML encoded, with the standard
+// XML header, as the Body on new requests (see Request()).
+// The bodyXML argument should be a pointer to an XML tagged struct.
+// A nil bodyXML leaves the body unchanged and records an error (see Err()).
+// See https://golang.org/pkg/encoding/xml/#Marshal for details.
+func (r *Nougat) BodyXML(bodyXML interface{}) *Nougat {
+	if bodyXML == nil {
+		r.setErr("BodyXML", errNilBody)
+		return r
+	}
+	return r.BodyProvider(xmlBodyProvider{payload: bodyXML})
+}
@@ -96,3 +96,35 @@ func TestBodyFormSetter(t *testing.T) {
 		}
 	}
 }
+
+func TestBodyXMLSetter(t *testing.T) {
+	fakeModel := &FakeModel{}
+	fakeBodyProvider := xmlBodyProvider{payload: fakeModel}
+
+	cases := []struct {
+		initial  BodyProvider
+		input    interface{}
+		expected BodyProvider
+	}{
+		// xml tagged struct is set as bodyXML
+		{nil, fakeModel, fakeBodyProvider},
+		// nil argument to bodyXML does not replace existing bodyXML
+		{fakeBodyProvider, nil, fakeBodyProvider},
+		// nil bodyXML remains nil
+		{nil, nil, nil},
+	}
+	for _, c := range cases {
+		Nougat := New()
+		Nougat.bodyProvider = c.initial
+		Nougat.BodyXML(c.input)
+		if Nougat.bodyProvider != c.expected {
+			t.Errorf("expected %v, got %v", c.expected, Nougat.bodyProvider)
+		}
+		// Header Content-Type should be application/xml if bodyXML arg was non-nil
+		if c.input != nil && Nougat.header.Get(contentType) != xmlContentType {
+			t.Errorf("Incorrect or missing header, expected %s, got %s", xmlContentType, Nougat.header.Get(contentType))
+		} else if c.input == nil && Nougat.header.Get(contentType) != "" {
+			t.Errorf("did not expect a Content-Type header, got %s", Nougat.header.Get(contentType))
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package nougat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerConsecutiveFailures = 5
+	defaultBreakerMinRequests         = 10
+	defaultBreakerWindow              = time.Minute
+	defaultBreakerCooldown            = 30 * time.Second
+	defaultBreakerHalfOpenRequests    = 1
+)
+
+// ErrCircuitOpen is returned by a CircuitBreaker for requests it rejects
+// without sending because their circuit is open.
+var ErrCircuitOpen = errors.New("nougat: circuit breaker is open")
+
+// CircuitState is the state of a circuit.
+type CircuitState int
+
+const (
+	// CircuitClosed sends requests and counts their failures.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects requests with ErrCircuitOpen until the cooldown
+	// has passed.
+	CircuitOpen
+	// CircuitHalfOpen sends a limited number of probe requests, closing
+	// the circuit if they succeed and opening it again if one fails.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+
+// BreakerPolicy configures when a CircuitBreaker opens and closes its
+// circuits. Zero values are replaced by defaults.
+type BreakerPolicy struct {
+	// Key returns the circuit of a request. Defaults to BreakerKeyHost.
+	Key func(req *http.Request) string
+	// ConsecutiveFailures opens the circuit after this many consecutive
+	// failures. Defaults to 5 if FailureRatio isn't set.
+	ConsecutiveFailures int
+	// FailureRatio opens the circuit when the ratio of failed requests in
+	// the current Window reaches it, once MinRequests have been sent.
+	FailureRatio float64
+	// MinRequests is the number of requests in a Window before
+	// FailureRatio applies. Defaults to 10.
+	MinRequests int
+	// Window is the period over which requests are counted for
+	// FailureRatio. Counts restart after each Window. Defaults to 1m.
+	Window time.Duration
+	// Cooldown is how long an open circuit rejects requests before
+	// becoming half-open. Defaults to 30s.
+	Cooldown time.Duration
+	// HalfOpenRequests is the number of probe requests sent by a
+	// half-open circuit, all of which must succeed to close it.
+	// Defaults to 1.
+	HalfOpenRequests int
+	// IsFailure reports whether a request failed. Defaults to any error or
+	// a 5XX response. Requests cancelled by their context are never
+	// counted.
+	IsFailure func(resp *http.Response, err error) bool
+	// OnStateChange, if set, is called when a circuit changes state.
+	OnStateChange func(key string, from, to CircuitState)
+}
+
+// BreakerKeyHost keys circuits by the request URL host.
+func BreakerKeyHost(req *http.Request) string {
+	return req.URL.Host
+}
+
+// BreakerKeyRoute keys circuits by the request URL host and route
+// template (see RouteTemplate), or path if it has none, so that one failing
+// endpoint doesn't open the circuit of a whole host.
+func BreakerKeyRoute(req *http.Request) string {
+	if template, ok := RouteTemplate(req); ok {
+		return req.URL.Host + template
+	}
+	return req.URL.Host + req.URL.Path
+}
+
+// CircuitBreaker is a Doer which stops sending requests to a failing
+// downstream. Each circuit starts closed and opens when its failures reach
+// the policy's threshold. An open circuit fails fast with ErrCircuitOpen
+// until its cooldown has passed, then lets probe requests through while
+// half-open, closing if they succeed.
+//
+// A CircuitBreaker is safe for concurrent use.
+type CircuitBreaker struct {
+	doer     Doer
+	policy   BreakerPolicy
+	circuits *circuits
+	// now returns the current time
+	now func() time.Time
+}
+
+// circuits are the circuits of a CircuitBreaker, shared by its copies.
+type circuits struct {
+	mu sync.Mutex
+	m  map[string]*circuit
+}
+
+// NewCircuitBreaker returns a CircuitBreaker which sends requests with the
+// given Doer. If a nil doer is given, the http.DefaultClient will be used.
+func NewCircuitBreaker(doer Doer, policy BreakerPolicy) *CircuitBreaker {
+	if doer == nil {
+		doer = http.DefaultClient
+	}
+	if policy.Key == nil {
+		policy.Key = BreakerKeyHost
+	}
+	if policy.ConsecutiveFailures <= 0 && policy.FailureRatio <= 0 {
+		policy.ConsecutiveFailures = defaultBreakerConsecutiveFailures
+	}
+	if policy.MinRequests <= 0 {
+		policy.MinRequests = defaultBreakerMinRequests
+	}
+	if policy.Window <= 0 {
+		policy.Window = defaultBreakerWindow
+	}
+	if policy.Cooldown <= 0 {
+		policy.Cooldown = defaultBreakerCooldown
+	}
+	if policy.HalfOpenRequests <= 0 {
+		policy.HalfOpenRequests = defaultBreakerHalfOpenRequests
+	}
+	if policy.IsFailure == nil {
+		policy.IsFailure = isBreakerFailure
+	}
+	return &CircuitBreaker{
+		doer:     doer,
+		policy:   policy,
+		circuits: &circuits{m: make(map[string]*circuit)},
+		now:      time.Now,
+	}
+}
+
+// Breaker returns Middleware which breaks circuits according to the given
+// policy. See CircuitBreaker. Requests sent through the Middleware share
+// its circuits.
+func Breaker(policy BreakerPolicy) Middleware {
+	return NewCircuitBreaker(nil, policy).Middleware()
+}
+
+// Middleware returns Middleware which sends requests through the
+// CircuitBreaker's circuits to the next Doer.
+func (b *CircuitBreaker) Middleware() Middleware {
+	return func(next Doer) Doer {
+		wrapped := *b
+		wrapped.doer = next
+		return &wrapped
+	}
+}
+
+// State returns the state of the circuit with the given key.
+func (b *CircuitBreaker) State(key string) CircuitState {
+	b.circuits.mu.Lock()
+	defer b.circuits.mu.Unlock()
+	if c, ok := b.circuits.m[key]; ok {
+		// an open circuit past its cooldown is half-open
+		if c.state == CircuitOpen && !b.now().Before(c.openedAt.Add(b.policy.Cooldown)) {
+			return CircuitHalfOpen
+		}
+		return c.state
+	}
+	return CircuitClosed
+}
+
+// Do sends the request unless its circuit is open, and records whether it
+// failed.
+func (b *CircuitBreaker) Do(req *http.Request) (*http.Response, error) {
+	key := b.policy.Key(req)
+	generation, err := b.allow(key)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.doer.Do(req)
+	switch {
+	case errors.Is(err, context.Canceled):
+		b.release(key, generation)
+	default:
+		b.record(key, generation, b.policy.IsFailure(resp, err))
+	}
+	return resp, err
+}
+
+// circuit is the state of the requests with one key.
+type circuit struct {
+	state CircuitState
+	// generation counts state changes, so outcomes of requests sent in an
+	// earlier state are ignored
+	generation uint64
+	openedAt   time.Time
+
+	// closed state counts
+	consecutive int
+	windowStart time.Time
+	requests    int
+	failures    int
+
+	// half-open state counts
+	probes    int
+	successes int
+}
+
+// allow returns the generation of the key's circuit if a request may be
+// sent, or an error wrapping ErrCircuitOpen.
+func (b *CircuitBreaker) allow(key string) (uint64, error) {
+	now := b.now()
+	var change func()
+	defer func() {
+		if change != nil {
+			change()
+		}
+	}()
+
+	b.circuits.mu.Lock()
+	defer b.circuits.mu.Unlock()
+	c, ok := b.circuits.m[key]
+	if !ok {
+		c = &circuit{windowStart: now}
+		b.circuits.m[key] = c
+	}
+	switch c.state {
+	case CircuitClosed:
+		if now.Sub(c.windowStart) >= b.policy.Window {
+			c.windowStart, c.requests, c.failures = now, 0, 0
+		}
+	case CircuitOpen:
+		if now.Before(c.openedAt.Add(b.policy.Cooldown)) {
+			return 0, fmt.Errorf("%w: %s", ErrCircuitOpen, key)
+		}
+		change = b.transition(key, c, CircuitHalfOpen, now)
+		fallthrough
+	case CircuitHalfOpen:
+		if c.probes >= b.policy.HalfOpenRequests {
+			return 0, fmt.Errorf("%w: %s", ErrCircuitOpen, key)
+		}
+		c.probes++
+	}
+	return c.generation, nil
+}
+
+// record counts the outcome of a request sent in the generation, changing
+// the circuit's state if needed.
+func (b *CircuitBreaker) record(key string, generation uint64, failed bool) {
+	now := b.now()
+	var change func()
+	defer func() {
+		if change != nil {
+			change()
+		}
+	}()
+
+	b.circuits.mu.Lock()
+	defer b.circuits.mu.Unlock()
+	c := b.circuits.m[key]
+	if c.generation != generation {
+		return
+	}
+	switch c.state {
+	case CircuitClosed:
+		c.requests++
+		if failed {
+			c.failures++
+			c.consecutive++
+		} else {
+			c.consecutive = 0
+		}
+		if b.tripped(c) {
+			change = b.transition(key, c, CircuitOpen, now)
+		}
+	case CircuitHalfOpen:
+		if failed {
+			change = b.transition(key, c, CircuitOpen, now)
+			return
+		}
+		c.successes++
+		if c.successes >= b.policy.HalfOpenRequests {
+			change = b.transition(key, c, CircuitClosed, now)
+		}
+	}
+}
+
+// release frees the probe of a request sent in the generation whose
+// outcome isn't counted.
+func (b *CircuitBreaker) release(key string, generation uint64) {
+	b.circuits.mu.Lock()
+	defer b.circuits.mu.Unlock()
+	c := b.circuits.m[key]
+	if c.generation == generation && c.state == CircuitHalfOpen {
+		c.probes--
+	}
+}
+
+// tripped reports whether the closed circuit's failures reach the policy's
+// thresholds.
+func (b *CircuitBreaker) tripped(c *circuit) bool {
+	if b.policy.ConsecutiveFailures > 0 && c.consecutive >= b.policy.ConsecutiveFailures {
+		return true
+	}
+	return b.policy.FailureRatio > 0 && c.requests >= b.policy.MinRequests &&
+		float64(c.failures)/float64(c.requests) >= b.policy.FailureRatio
+}
+
+// transition changes the circuit's state, resetting its counts, and returns
+// a function calling OnStateChange, to be called without holding the lock.
+func (b *CircuitBreaker) transition(key string, c *circuit, to CircuitState, now time.Time) func() {
+	from := c.state
+	*c = circuit{
+		state:       to,
+		generation:  c.generation + 1,
+		openedAt:    now,
+		windowStart: now,
+	}
+	if b.policy.OnStateChange == nil {
+		return nil
+	}
+	return func() {
+		b.policy.OnStateChange(key, from, to)
+	}
+}
+
+// isBreakerFailure reports whether a request failed with an error or a
+// 5XX response.
+func isBreakerFailure(resp *http.Response, err error) bool {
+	return err != nil || resp.StatusCode >= 500
+}
@@ -0,0 +1,205 @@
+package nougat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// statusDoer responds with the status codes it is given, in order, or fails
+// with errDown for status 0.
+type statusDoer struct {
+	statuses []int
+	calls    int
+}
+
+var errDown = errors.New("connection refused")
+
+func (d *statusDoer) Do(req *http.Request) (*http.Response, error) {
+	status := d.statuses[d.calls%len(d.statuses)]
+	d.calls++
+	if status == 0 {
+		return nil, errDown
+	}
+	return &http.Response{StatusCode: status, Body: http.NoBody, Request: req}, nil
+}
+
+// newTestBreaker returns a CircuitBreaker using the clock which records
+// its state changes.
+func newTestBreaker(doer Doer, policy BreakerPolicy, clock *fakeClock, changes *[]string) *CircuitBreaker {
+	policy.OnStateChange = func(key string, from, to CircuitState) {
+		*changes = append(*changes, fmt.Sprintf("%s: %s -> %s", key, from, to))
+	}
+	breaker := NewCircuitBreaker(doer, policy)
+	breaker.now = clock.Now
+	return breaker
+}
+
+func TestCircuitBreaker_consecutiveFailures(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	doer := &statusDoer{statuses: []int{500, 0, 200, 503, 0, 500}}
+	var changes []string
+	breaker := newTestBreaker(doer, BreakerPolicy{ConsecutiveFailures: 3, Cooldown: time.Minute}, clock, &changes)
+	sender := New().Doer(breaker).Get("http://a.io/foo")
+
+	// a success resets the consecutive failures
+	for i := 0; i < 6; i++ {
+		sender.Receive(nil, nil)
+	}
+	if state := breaker.State("a.io"); state != CircuitOpen {
+		t.Errorf("expected %s, got %s", CircuitOpen, state)
+	}
+	_, err := sender.Receive(nil, nil)
+	if !errors.Is(err, ErrCircuitOpen) || err.Error() != "nougat: circuit breaker is open: a.io" {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+	if doer.calls != 6 {
+		t.Errorf("expected open circuit to fail fast, got %d calls", doer.calls)
+	}
+	// other hosts have their own circuit
+	if state := breaker.State("b.io"); state != CircuitClosed {
+		t.Errorf("expected %s, got %s", CircuitClosed, state)
+	}
+
+	// after the cooldown a failed probe opens the circuit again
+	clock.Advance(time.Minute)
+	if state := breaker.State("a.io"); state != CircuitHalfOpen {
+		t.Errorf("expected %s, got %s", CircuitHalfOpen, state)
+	}
+	doer.statuses, doer.calls = []int{502}, 0
+	sender.Receive(nil, nil)
+	if _, err := sender.Receive(nil, nil); !errors.Is(err, ErrCircuitOpen) || doer.calls != 1 {
+		t.Errorf("expected one probe, got %d calls and %v", doer.calls, err)
+	}
+
+	// a successful probe closes the circuit
+	clock.Advance(time.Minute)
+	doer.statuses = []int{200}
+	if _, err := sender.Receive(nil, nil); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if state := breaker.State("a.io"); state != CircuitClosed {
+		t.Errorf("expected %s, got %s", CircuitClosed, state)
+	}
+	expected := []string{
+		"a.io: closed -> open",
+		"a.io: open -> half-open",
+		"a.io: half-open -> open",
+		"a.io: open -> half-open",
+		"a.io: half-open -> closed",
+	}
+	if !reflect.DeepEqual(expected, changes) {
+		t.Errorf("expected %v, got %v", expected, changes)
+	}
+}
+
+func TestCircuitBreaker_failureRatio(t *testing.T) {
+	cases := []struct {
+		statuses      []int
+		advance       time.Duration
+		expectedState CircuitState
+	}{
+		// 5 of 10 failures
+		{[]int{500, 200}, 0, CircuitOpen},
+		// 4 of 10 failures
+		{[]int{500, 200, 200}, 0, CircuitClosed},
+		// counts restart after each window
+		{[]int{500, 200}, 7 * time.Second, CircuitClosed},
+	}
+	for _, c := range cases {
+		clock := &fakeClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+		var changes []string
+		breaker := newTestBreaker(&statusDoer{statuses: c.statuses}, BreakerPolicy{FailureRatio: 0.5, MinRequests: 10, Window: time.Minute}, clock, &changes)
+		for i := 0; i < 10; i++ {
+			New().Doer(breaker).Get("http://a.io/foo").Receive(nil, nil)
+			clock.Advance(c.advance)
+		}
+		if state := breaker.State("a.io"); state != c.expectedState {
+			t.Errorf("expected %s, got %s", c.expectedState, state)
+		}
+	}
+}
+
+func TestCircuitBreaker_halfOpenRequests(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	doer := &statusDoer{statuses: []int{500}}
+	var changes []string
+	breaker := newTestBreaker(doer, BreakerPolicy{ConsecutiveFailures: 1, HalfOpenRequests: 2}, clock, &changes)
+	req, _ := New().Get("http://a.io/foo").Request()
+	breaker.Do(req)
+	clock.Advance(30 * time.Second)
+
+	// probes are limited while their outcomes are pending
+	doer.statuses = []int{200}
+	first, _ := breaker.allow("a.io")
+	second, _ := breaker.allow("a.io")
+	if _, err := breaker.allow("a.io"); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+	breaker.record("a.io", first, false)
+	if state := breaker.State("a.io"); state != CircuitHalfOpen {
+		t.Errorf("expected %s, got %s", CircuitHalfOpen, state)
+	}
+	breaker.record("a.io", second, false)
+	if state := breaker.State("a.io"); state != CircuitClosed {
+		t.Errorf("expected %s, got %s", CircuitClosed, state)
+	}
+	// outcomes from an earlier state are ignored
+	breaker.record("a.io", first, true)
+	if state := breaker.State("a.io"); state != CircuitClosed {
+		t.Errorf("expected %s, got %s", CircuitClosed, state)
+	}
+}
+
+func TestCircuitBreaker_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, req.Context().Err()
+	})
+	breaker := NewCircuitBreaker(doer, BreakerPolicy{ConsecutiveFailures: 1})
+	req, _ := New().Get("http://a.io/foo").Request()
+	if _, err := breaker.Do(req.WithContext(ctx)); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	if state := breaker.State("a.io"); state != CircuitClosed {
+		t.Errorf("expected cancellations not to count, got %s", state)
+	}
+}
+
+func TestBreaker_routeKeys(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+	})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	})
+
+	var changes []string
+	base := New().Client(client).Base("http://example.com/").Use(Breaker(BreakerPolicy{
+		Key:                 BreakerKeyRoute,
+		ConsecutiveFailures: 2,
+		OnStateChange: func(key string, from, to CircuitState) {
+			changes = append(changes, fmt.Sprintf("%s: %s -> %s", key, from, to))
+		},
+	}))
+	// requests for different users share the route's circuit
+	base.New().Get("users/{id}").PathParam("id", "1").Receive(nil, nil)
+	base.New().Get("users/{id}").PathParam("id", "2").Receive(nil, nil)
+	if _, err := base.New().Get("users/{id}").PathParam("id", "3").Receive(nil, nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected ErrCircuitOpen, got %v", err)
+	}
+	if _, err := base.New().Get("health").Receive(nil, nil); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	expected := []string{"example.com/users/{id}: closed -> open"}
+	if !reflect.DeepEqual(expected, changes) {
+		t.Errorf("expected %v, got %v", expected, changes)
+	}
+}
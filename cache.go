@@ -0,0 +1,690 @@
+package nougat
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultCacheEntries is the size of the MemoryCache used when CacheOptions
+// has no Store.
+const defaultCacheEntries = 1000
+
+// maxCacheBodyBytes is the size of the largest response body a Cacher
+// stores.
+const maxCacheBodyBytes = 10 << 20
+
+// heuristicStatusCodes are the response status codes which may be cached
+// without explicit freshness information (RFC 9110 section 15.1).
+var heuristicStatusCodes = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusNoContent:            true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusPermanentRedirect:    true,
+	http.StatusNotFound:             true,
+	http.StatusMethodNotAllowed:     true,
+	http.StatusGone:                 true,
+	http.StatusRequestURITooLong:    true,
+	http.StatusNotImplemented:       true,
+}
+
+// streamingMediaTypes are the media types of responses which are streamed,
+// so they are passed through a Cacher without being stored.
+var streamingMediaTypes = map[string]bool{
+	eventStreamContentType:    true,
+	"application/x-ndjson":    true,
+	"application/ndjson":      true,
+	"application/jsonl":       true,
+	"application/x-jsonlines": true,
+	"application/json-seq":    true,
+}
+
+// CacheStore stores cached responses. Implementations must be safe for
+// concurrent use.
+type CacheStore interface {
+	// Get returns the value stored for key, if any.
+	Get(key string) ([]byte, bool)
+	// Set stores the value for key.
+	Set(key string, value []byte)
+	// Delete removes the value stored for key.
+	Delete(key string)
+}
+
+// CacheOptions configures a Cacher.
+type CacheOptions struct {
+	// Store stores cached responses. Defaults to a MemoryCache of 1000
+	// entries.
+	Store CacheStore
+}
+
+// Cacher is a Doer which caches responses to GET and HEAD requests
+// following RFC 9111 as a private cache.
+//
+// Fresh responses, according to their Cache-Control max-age or Expires
+// headers or heuristically from Last-Modified, are served from the store.
+// Responses are stored once their body has been read to the end, up to
+// 10MB, so they are still streamed to the caller. Responses without
+// explicit freshness or a validator, and text/event-stream and NDJSON
+// responses, aren't stored.
+// Stale responses with an ETag or Last-Modified validator are revalidated
+// with a conditional request, and a 304 Not Modified response is replaced
+// with the stored response, so decoders see the full body. Responses vary
+// by the request headers named in their Vary header. Responses with
+// Cache-Control no-store aren't stored, and successful unsafe requests,
+// such as POST, invalidate the responses stored for their URL. Entries
+// aren't keyed by credentials, so responses to requests with an
+// Authorization header are only stored if they are Cache-Control public or
+// have an s-maxage, as in a shared cache.
+//
+// The request Cache-Control directives no-cache, no-store, max-age,
+// max-stale, min-fresh and only-if-cached are honoured: no-store requests
+// bypass the cache and no-cache requests are always revalidated. Requests with
+// their own conditional headers bypass the cache.
+type Cacher struct {
+	doer  Doer
+	store CacheStore
+	// now returns the current time
+	now func() time.Time
+}
+
+// NewCacher returns a Cacher which sends requests with the given Doer.
+// If a nil doer is given, the http.DefaultClient will be used.
+func NewCacher(doer Doer, opts CacheOptions) *Cacher {
+	if doer == nil {
+		doer = http.DefaultClient
+	}
+	if opts.Store == nil {
+		opts.Store = NewMemoryCache(defaultCacheEntries)
+	}
+	return &Cacher{doer: doer, store: opts.Store, now: time.Now}
+}
+
+// Cache returns Middleware which caches responses according to the given
+// options. See Cacher. Requests sent through the Middleware share its
+// store.
+func Cache(opts CacheOptions) Middleware {
+	if opts.Store == nil {
+		opts.Store = NewMemoryCache(defaultCacheEntries)
+	}
+	return func(next Doer) Doer {
+		return NewCacher(next, opts)
+	}
+}
+
+// cacheEntry is a stored response.
+type cacheEntry struct {
+	StatusCode int         `json:"status_code"`
+	Status     string      `json:"status"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	// Vary holds the request header values named by the Vary header.
+	Vary         http.Header `json:"vary,omitempty"`
+	RequestTime  time.Time   `json:"request_time"`
+	ResponseTime time.Time   `json:"response_time"`
+}
+
+// Do sends the request, or responds with a stored response.
+func (c *Cacher) Do(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		resp, err := c.doer.Do(req)
+		if err == nil && !isSafeMethod(req.Method) && resp.StatusCode < 400 {
+			c.invalidate(req, resp)
+		}
+		return resp, err
+	}
+	reqCC := parseCacheControl(req.Header)
+	if _, ok := reqCC["no-store"]; ok || hasConditionalHeaders(req.Header) {
+		return c.doer.Do(req)
+	}
+
+	key := cacheKey(req.Method, req.URL)
+	entry := c.load(key)
+	if entry != nil && !entry.varyMatches(req) {
+		entry = nil
+	}
+	if entry == nil {
+		if _, ok := reqCC["only-if-cached"]; ok {
+			return gatewayTimeout(req), nil
+		}
+		return c.fetch(req, key, nil)
+	}
+	if c.fresh(entry, reqCC) {
+		return entry.response(req, c.now()), nil
+	}
+	if _, ok := reqCC["only-if-cached"]; ok {
+		return gatewayTimeout(req), nil
+	}
+	return c.fetch(req, key, entry)
+}
+
+// fetch sends the request, conditionally if the stale entry has
+// validators, and stores the response if it may be cached.
+func (c *Cacher) fetch(req *http.Request, key string, stale *cacheEntry) (*http.Response, error) {
+	out := req
+	if stale != nil {
+		etag := stale.Header.Get("ETag")
+		lastModified := stale.Header.Get("Last-Modified")
+		if etag != "" || lastModified != "" {
+			out = req.Clone(req.Context())
+			if etag != "" {
+				out.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				out.Header.Set("If-Modified-Since", lastModified)
+			}
+		} else {
+			stale = nil
+		}
+	}
+
+	requestTime := c.now()
+	resp, err := c.doer.Do(out)
+	if err != nil {
+		return resp, err
+	}
+	responseTime := c.now()
+
+	if stale != nil && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		stale.update(resp.Header, requestTime, responseTime)
+		c.save(key, stale)
+		return stale.response(req, responseTime), nil
+	}
+
+	if !cacheable(req, resp) {
+		if _, ok := parseCacheControl(resp.Header)["no-store"]; ok {
+			c.store.Delete(key)
+		}
+		return resp, nil
+	}
+	entry := &cacheEntry{
+		StatusCode:   resp.StatusCode,
+		Status:       resp.Status,
+		Header:       cloneHeader(resp.Header),
+		Vary:         varyHeader(req, resp.Header),
+		RequestTime:  requestTime,
+		ResponseTime: responseTime,
+	}
+	resp.Body = &cachingBody{ReadCloser: resp.Body, save: func(body []byte) {
+		entry.Body = body
+		c.save(key, entry)
+	}}
+	return resp, nil
+}
+
+// cachingBody is a response body which is stored once it has been read to
+// the end, so the response is streamed to the caller rather than buffered.
+// Bodies which are closed early or are larger than maxCacheBodyBytes aren't
+// stored.
+type cachingBody struct {
+	io.ReadCloser
+	buf bytes.Buffer
+	// save stores the complete body
+	save func(body []byte)
+	done bool
+}
+
+func (b *cachingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.done {
+		return n, err
+	}
+	if b.buf.Len()+n > maxCacheBodyBytes {
+		b.done = true
+		b.buf = bytes.Buffer{}
+		return n, err
+	}
+	b.buf.Write(p[:n])
+	if err == io.EOF {
+		b.done = true
+		b.save(b.buf.Bytes())
+	}
+	return n, err
+}
+
+// fresh reports whether the entry may be served without revalidation,
+// according to its freshness and the request's directives.
+func (c *Cacher) fresh(entry *cacheEntry, reqCC map[string]string) bool {
+	if _, ok := reqCC["no-cache"]; ok {
+		return false
+	}
+	respCC := parseCacheControl(entry.Header)
+	if _, ok := respCC["no-cache"]; ok {
+		return false
+	}
+	lifetime := entry.freshnessLifetime(respCC)
+	age := entry.age(c.now())
+	if maxAge, ok := cacheSeconds(reqCC, "max-age"); ok && age > maxAge {
+		return false
+	}
+	if minFresh, ok := cacheSeconds(reqCC, "min-fresh"); ok {
+		age += minFresh
+	}
+	if age < lifetime {
+		return true
+	}
+	if _, ok := respCC["must-revalidate"]; ok {
+		return false
+	}
+	if value, ok := reqCC["max-stale"]; ok {
+		if value == "" {
+			return true
+		}
+		maxStale, _ := cacheSeconds(reqCC, "max-stale")
+		return age-lifetime <= maxStale
+	}
+	return false
+}
+
+// invalidate deletes the entries for the URLs affected by a successful
+// unsafe request: its URL and its response's same-origin Location and
+// Content-Location.
+func (c *Cacher) invalidate(req *http.Request, resp *http.Response) {
+	urls := []*url.URL{req.URL}
+	for _, name := range []string{"Location", "Content-Location"} {
+		if value := resp.Header.Get(name); value != "" {
+			if u, err := req.URL.Parse(value); err == nil && u.Scheme == req.URL.Scheme && u.Host == req.URL.Host {
+				urls = append(urls, u)
+			}
+		}
+	}
+	for _, u := range urls {
+		c.store.Delete(cacheKey(http.MethodGet, u))
+		c.store.Delete(cacheKey(http.MethodHead, u))
+	}
+}
+
+// load returns the entry stored for key, or nil.
+func (c *Cacher) load(key string) *cacheEntry {
+	data, ok := c.store.Get(key)
+	if !ok {
+		return nil
+	}
+	entry := new(cacheEntry)
+	if err := json.Unmarshal(data, entry); err != nil {
+		c.store.Delete(key)
+		return nil
+	}
+	return entry
+}
+
+// save stores the entry for key.
+func (c *Cacher) save(key string, entry *cacheEntry) {
+	if data, err := json.Marshal(entry); err == nil {
+		c.store.Set(key, data)
+	}
+}
+
+// freshnessLifetime returns how long after it was generated the entry is
+// fresh.
+func (e *cacheEntry) freshnessLifetime(respCC map[string]string) time.Duration {
+	if maxAge, ok := cacheSeconds(respCC, "max-age"); ok {
+		return maxAge
+	}
+	date := e.date()
+	if expires := e.Header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil || !t.After(date) {
+			// invalid dates, such as "0", are in the past
+			return 0
+		}
+		return t.Sub(date)
+	}
+	if lastModified, err := http.ParseTime(e.Header.Get("Last-Modified")); err == nil && heuristicStatusCodes[e.StatusCode] {
+		if lastModified.Before(date) {
+			return date.Sub(lastModified) / 10
+		}
+	}
+	return 0
+}
+
+// age returns the entry's current age (RFC 9111 section 4.2.3).
+func (e *cacheEntry) age(now time.Time) time.Duration {
+	apparentAge := e.ResponseTime.Sub(e.date())
+	if apparentAge < 0 {
+		apparentAge = 0
+	}
+	responseDelay := e.ResponseTime.Sub(e.RequestTime)
+	ageValue, _ := strconv.Atoi(e.Header.Get("Age"))
+	correctedAge := time.Duration(ageValue)*time.Second + responseDelay
+	if correctedAge > apparentAge {
+		apparentAge = correctedAge
+	}
+	return apparentAge + now.Sub(e.ResponseTime)
+}
+
+// date returns the time the response was generated, from its Date header
+// or else the time it was received.
+func (e *cacheEntry) date() time.Time {
+	if date, err := http.ParseTime(e.Header.Get("Date")); err == nil {
+		return date
+	}
+	return e.ResponseTime
+}
+
+// varyMatches reports whether the request has the header values the entry
+// varies by.
+func (e *cacheEntry) varyMatches(req *http.Request) bool {
+	for _, name := range headerTokens(e.Header, "Vary") {
+		if strings.Join(req.Header.Values(name), ",") != strings.Join(e.Vary.Values(name), ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// update merges the headers of a 304 Not Modified response into the entry
+// and resets its age (RFC 9111 section 4.3.4).
+func (e *cacheEntry) update(header http.Header, requestTime, responseTime time.Time) {
+	for key, values := range header {
+		switch http.CanonicalHeaderKey(key) {
+		case "Content-Length", "Content-Encoding", "Transfer-Encoding", "Content-Range":
+			continue
+		}
+		e.Header[key] = append([]string(nil), values...)
+	}
+	if header.Get("Age") == "" {
+		e.Header.Del("Age")
+	}
+	e.RequestTime = requestTime
+	e.ResponseTime = responseTime
+}
+
+// response returns the entry as a response to the request, with its Age.
+func (e *cacheEntry) response(req *http.Request, now time.Time) *http.Response {
+	header := cloneHeader(e.Header)
+	header.Set("Age", strconv.Itoa(int(e.age(now)/time.Second)))
+	body := e.Body
+	if req.Method == http.MethodHead {
+		body = nil
+	}
+	return &http.Response{
+		Status:        e.Status,
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// cacheable reports whether the response to the request may be stored
+// (RFC 9111 section 3) and could later be served or revalidated: it has
+// explicit freshness, or a validator and a status code which may be fresh
+// heuristically. Streamed media types are never stored, nor are responses
+// to authorized requests which the server didn't explicitly allow to be
+// shared (RFC 9111 section 3.5).
+func cacheable(req *http.Request, resp *http.Response) bool {
+	respCC := parseCacheControl(resp.Header)
+	if _, ok := respCC["no-store"]; ok {
+		return false
+	}
+	_, public := respCC["public"]
+	if _, sMaxAge := respCC["s-maxage"]; req.Header.Get("Authorization") != "" && !public && !sMaxAge {
+		return false
+	}
+	for _, name := range headerTokens(resp.Header, "Vary") {
+		if name == "*" {
+			return false
+		}
+	}
+	if streamingMediaTypes[normalizeMediaType(resp.Header.Get(contentType))] {
+		return false
+	}
+	_, maxAge := respCC["max-age"]
+	if maxAge || resp.Header.Get("Expires") != "" {
+		return true
+	}
+	validator := resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != ""
+	return validator && (heuristicStatusCodes[resp.StatusCode] || public)
+}
+
+// varyHeader returns the request header values named by the response's
+// Vary header.
+func varyHeader(req *http.Request, header http.Header) http.Header {
+	names := headerTokens(header, "Vary")
+	if len(names) == 0 {
+		return nil
+	}
+	vary := make(http.Header)
+	for _, name := range names {
+		for _, value := range req.Header.Values(name) {
+			vary.Add(name, value)
+		}
+	}
+	return vary
+}
+
+// parseCacheControl returns the directives of the Cache-Control header,
+// with lower-cased names and unquoted values. A request Pragma: no-cache
+// without a Cache-Control header is treated as no-cache.
+func parseCacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "" {
+				continue
+			}
+			name, arg := splitPair(directive, "=")
+			directives[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(arg), `"`)
+		}
+	}
+	if len(directives) == 0 && strings.EqualFold(header.Get("Pragma"), "no-cache") {
+		directives["no-cache"] = ""
+	}
+	return directives
+}
+
+// cacheSeconds returns the directive's delta-seconds value as a Duration.
+// ok is false if the directive is absent or invalid.
+func cacheSeconds(directives map[string]string, name string) (d time.Duration, ok bool) {
+	value, present := directives[name]
+	if !present {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// headerTokens returns the comma separated tokens of the header, in
+// canonical header key form.
+func headerTokens(header http.Header, name string) []string {
+	var tokens []string
+	for _, value := range header.Values(name) {
+		for _, token := range strings.Split(value, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, http.CanonicalHeaderKey(token))
+			}
+		}
+	}
+	return tokens
+}
+
+// hasConditionalHeaders reports whether the request has its own
+// conditional headers.
+func hasConditionalHeaders(header http.Header) bool {
+	for _, name := range []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range", "Range"} {
+		if header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// isSafeMethod reports whether the method is safe (RFC 9110 section 9.2.1).
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// cacheKey returns the store key for the method and URL.
+func cacheKey(method string, u *url.URL) string {
+	return method + " " + u.String()
+}
+
+// gatewayTimeout returns the 504 response to an only-if-cached request
+// which can't be served from the cache (RFC 9111 section 5.2.1.7).
+func gatewayTimeout(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:     "504 Gateway Timeout",
+		StatusCode: http.StatusGatewayTimeout,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       http.NoBody,
+		Request:    req,
+	}
+}
+
+// MemoryCache is a CacheStore which keeps a bounded number of entries in
+// memory, evicting the least recently used.
+type MemoryCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// memoryCacheItem is a MemoryCache entry.
+type memoryCacheItem struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryCache returns a MemoryCache which holds up to maxEntries
+// entries. If maxEntries is zero or less, the number isn't bounded.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// Get returns the value stored for key, if any.
+func (m *MemoryCache) Get(key string) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	elem, ok := m.entries[key]
+	if !ok {
+		return nil, false
+	}
+	m.order.MoveToFront(elem)
+	return elem.Value.(*memoryCacheItem).value, true
+}
+
+// Set stores the value for key, evicting the least recently used entry if
+// the cache is full.
+func (m *MemoryCache) Set(key string, value []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if elem, ok := m.entries[key]; ok {
+		elem.Value.(*memoryCacheItem).value = value
+		m.order.MoveToFront(elem)
+		return
+	}
+	m.entries[key] = m.order.PushFront(&memoryCacheItem{key: key, value: value})
+	if m.maxEntries > 0 && m.order.Len() > m.maxEntries {
+		oldest := m.order.Back()
+		m.order.Remove(oldest)
+		delete(m.entries, oldest.Value.(*memoryCacheItem).key)
+	}
+}
+
+// Delete removes the value stored for key.
+func (m *MemoryCache) Delete(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if elem, ok := m.entries[key]; ok {
+		m.order.Remove(elem)
+		delete(m.entries, key)
+	}
+}
+
+// Len returns the number of entries.
+func (m *MemoryCache) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.order.Len()
+}
+
+// DiskCache is a CacheStore which keeps entries as files in a directory,
+// so they persist across processes. Entries which can't be written are
+// dropped.
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache returns a DiskCache which stores entries in dir, creating
+// it when needed.
+func NewDiskCache(dir string) *DiskCache {
+	return &DiskCache{dir: dir}
+}
+
+// Get returns the value stored for key, if any.
+func (d *DiskCache) Get(key string) ([]byte, bool) {
+	data, err := ioutil.ReadFile(d.path(key))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// Set stores the value for key. The file is replaced atomically, so
+// concurrent readers never see a partial entry.
+func (d *DiskCache) Set(key string, value []byte) {
+	if err := os.MkdirAll(d.dir, 0700); err != nil {
+		return
+	}
+	f, err := ioutil.TempFile(d.dir, ".tmp-")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(value)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), d.path(key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+// Delete removes the value stored for key.
+func (d *DiskCache) Delete(key string) {
+	os.Remove(d.path(key))
+}
+
+// path returns the path of the file for key.
+func (d *DiskCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(d.dir, hex.EncodeToString(sum[:]))
+}
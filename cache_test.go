@@ -0,0 +1,440 @@
+package nougat
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable clock.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+// newTestCacher returns a Cacher sending requests with client and using
+// the clock.
+func newTestCacher(client *http.Client, clock *fakeClock) *Cacher {
+	cacher := NewCacher(client, CacheOptions{})
+	cacher.now = clock.Now
+	return cacher
+}
+
+func TestCacher_freshness(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	clock := &fakeClock{now: start}
+	cases := []struct {
+		header         http.Header
+		statusCode     int
+		advance        time.Duration
+		expectedCalls  int
+		expectedCached bool
+	}{
+		{http.Header{"Cache-Control": {"max-age=60"}}, 200, 30 * time.Second, 1, true},
+		{http.Header{"Cache-Control": {"public, max-age=60"}}, 200, 61 * time.Second, 2, false},
+		{http.Header{"Expires": {clock.now.Add(time.Minute).Format(http.TimeFormat)}}, 200, 30 * time.Second, 1, true},
+		{http.Header{"Expires": {"0"}}, 200, 0, 2, false},
+		// max-age takes precedence over Expires
+		{http.Header{"Cache-Control": {"max-age=0"}, "Expires": {clock.now.Add(time.Minute).Format(http.TimeFormat)}}, 200, 0, 2, false},
+		// Age reduces freshness
+		{http.Header{"Cache-Control": {"max-age=60"}, "Age": {"50"}}, 200, 20 * time.Second, 2, false},
+		// heuristic freshness is 10% of the time since Last-Modified
+		{http.Header{"Last-Modified": {clock.now.Add(-100 * time.Minute).Format(http.TimeFormat)}}, 200, 9 * time.Minute, 1, true},
+		{http.Header{"Last-Modified": {clock.now.Add(-100 * time.Minute).Format(http.TimeFormat)}}, 200, 11 * time.Minute, 2, false},
+		{http.Header{"Cache-Control": {"no-store, max-age=60"}}, 200, 0, 2, false},
+		{http.Header{"Cache-Control": {"max-age=60"}, "Vary": {"*"}}, 200, 0, 2, false},
+		{http.Header{"Cache-Control": {"max-age=60"}}, 404, 0, 1, true},
+		// status codes which aren't heuristically cacheable need explicit freshness
+		{http.Header{"Last-Modified": {clock.now.Add(-100 * time.Minute).Format(http.TimeFormat)}}, 500, 0, 2, false},
+		{http.Header{"Cache-Control": {"max-age=60"}}, 500, 0, 1, true},
+		// responses without freshness or a validator could never be served
+		{http.Header{}, 200, 0, 2, false},
+		{http.Header{"Cache-Control": {"public"}}, 200, 0, 2, false},
+	}
+	for i, c := range cases {
+		clock.now = start
+		client, mux, server := testServer()
+		var calls int
+		mux.HandleFunc("/rates", func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			for key, values := range c.header {
+				w.Header()[key] = values
+			}
+			w.Header().Set("Date", clock.now.Format(http.TimeFormat))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(c.statusCode)
+			fmt.Fprintf(w, `{"text": "call %d"}`, calls)
+		})
+		cacher := newTestCacher(client, clock)
+
+		New().Doer(cacher).Get("http://example.com/rates").Receive(nil, nil)
+		clock.Advance(c.advance)
+		model, failure := new(FakeModel), new(FakeModel)
+		resp, err := New().Doer(cacher).Get("http://example.com/rates").Receive(model, failure)
+		if err != nil {
+			t.Errorf("%d: expected nil, got %v", i, err)
+		}
+		if calls != c.expectedCalls {
+			t.Errorf("%d: expected %d calls, got %d", i, c.expectedCalls, calls)
+		}
+		if resp.StatusCode != c.statusCode {
+			t.Errorf("%d: expected %d, got %d", i, c.statusCode, resp.StatusCode)
+		}
+		// the cached body is decoded into successV or failureV
+		expectedText := fmt.Sprintf("call %d", calls)
+		if text := model.Text + failure.Text; text != expectedText {
+			t.Errorf("%d: expected %s, got %s", i, expectedText, text)
+		}
+		expectedAge, _ := strconv.Atoi(c.header.Get("Age"))
+		expectedAge += int(c.advance / time.Second)
+		if age := resp.Header.Get("Age"); c.expectedCached && age != strconv.Itoa(expectedAge) {
+			t.Errorf("%d: expected Age %d, got %q", i, expectedAge, age)
+		}
+		server.Close()
+	}
+}
+
+func TestCacher_revalidation(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	lastModified := clock.now.Add(-time.Hour).Format(http.TimeFormat)
+	cases := []struct {
+		header              http.Header
+		expectedConditional http.Header
+	}{
+		{http.Header{"Etag": {`"v1"`}, "Cache-Control": {"no-cache"}}, http.Header{"If-None-Match": {`"v1"`}}},
+		{http.Header{"Etag": {`W/"v1"`}, "Cache-Control": {"max-age=0"}}, http.Header{"If-None-Match": {`W/"v1"`}}},
+		{http.Header{"Last-Modified": {lastModified}, "Cache-Control": {"max-age=0"}}, http.Header{"If-Modified-Since": {lastModified}}},
+	}
+	for _, c := range cases {
+		client, mux, server := testServer()
+		var calls, notModified int
+		mux.HandleFunc("/rates", func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			for key, values := range c.header {
+				w.Header()[key] = values
+			}
+			if calls > 1 {
+				for key := range c.expectedConditional {
+					if value := r.Header.Get(key); value != c.expectedConditional.Get(key) {
+						t.Errorf("expected %s %s, got %q", key, c.expectedConditional.Get(key), value)
+					}
+				}
+				notModified++
+				w.Header().Set("X-Version", fmt.Sprint(calls))
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"text": "rates"}`)
+		})
+		cacher := newTestCacher(client, clock)
+
+		for i := 0; i < 3; i++ {
+			model := new(FakeModel)
+			resp, err := New().Doer(cacher).Get("http://example.com/rates").ReceiveSuccess(model)
+			if err != nil {
+				t.Errorf("expected nil, got %v", err)
+			}
+			if resp.StatusCode != 200 || model.Text != "rates" {
+				t.Errorf("expected the cached body, got %d %v", resp.StatusCode, model)
+			}
+			// 304 headers are merged into the stored response
+			if i > 0 && resp.Header.Get("X-Version") != fmt.Sprint(i+1) {
+				t.Errorf("expected X-Version %d, got %q", i+1, resp.Header.Get("X-Version"))
+			}
+		}
+		if calls != 3 || notModified != 2 {
+			t.Errorf("expected 3 calls with 2 revalidations, got %d %d", calls, notModified)
+		}
+		server.Close()
+	}
+}
+
+func TestCacher_requestDirectives(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	client, mux, server := testServer()
+	defer server.Close()
+	var calls int
+	mux.HandleFunc("/rates", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprint(w, "rates")
+	})
+
+	cases := []struct {
+		cacheControl   string
+		advance        time.Duration
+		expectedCalls  int
+		expectedStatus int
+	}{
+		{"", 0, 1, 200},
+		{"no-cache", 0, 2, 200},
+		{"no-store", 0, 2, 200},
+		{"max-age=10", 20 * time.Second, 2, 200},
+		{"min-fresh=50", 20 * time.Second, 2, 200},
+		{"max-stale=30", 80 * time.Second, 1, 200},
+		{"max-stale=10", 80 * time.Second, 2, 200},
+		{"max-stale", time.Hour, 1, 200},
+		{"only-if-cached", 0, 1, 200},
+		{"only-if-cached", 2 * time.Minute, 1, 504},
+	}
+	for _, c := range cases {
+		calls = 0
+		cacher := newTestCacher(client, clock)
+		New().Doer(cacher).Get("http://example.com/rates").Receive(nil, nil)
+		clock.Advance(c.advance)
+		resp, err := New().Doer(cacher).Get("http://example.com/rates").Set("Cache-Control", c.cacheControl).Receive(nil, nil)
+		if err != nil {
+			t.Errorf("%s: expected nil, got %v", c.cacheControl, err)
+		}
+		if calls != c.expectedCalls || resp.StatusCode != c.expectedStatus {
+			t.Errorf("%s: expected %d calls and %d, got %d calls and %d", c.cacheControl, c.expectedCalls, c.expectedStatus, calls, resp.StatusCode)
+		}
+	}
+
+	// only-if-cached without a stored response
+	req, _ := New().Get("http://example.com/rates").Set("Cache-Control", "only-if-cached").Request()
+	resp, err := newTestCacher(client, clock).Do(req)
+	if err != nil || resp.StatusCode != http.StatusGatewayTimeout {
+		t.Errorf("expected 504, got %v %v", resp, err)
+	}
+}
+
+func TestCacher_vary(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	var calls int
+	mux.HandleFunc("/greeting", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprint(w, r.Header.Get("Accept-Language"))
+	})
+
+	cacher := NewCacher(client, CacheOptions{})
+	for _, language := range []string{"en", "en", "sw", "sw"} {
+		req, _ := New().Get("http://example.com/greeting").Set("Accept-Language", language).Request()
+		resp, err := cacher.Do(req)
+		if err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		if string(body) != language {
+			t.Errorf("expected %s, got %s", language, body)
+		}
+	}
+	// the second language replaces the first variant
+	if calls != 2 {
+		t.Errorf("expected %d calls, got %d", 2, calls)
+	}
+}
+
+func TestCacher_authorization(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	var calls int
+	mux.HandleFunc("/me", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprint(w, r.Header.Get("Authorization"))
+	})
+	mux.HandleFunc("/shared", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		fmt.Fprint(w, "shared")
+	})
+
+	cacher := NewCacher(client, CacheOptions{})
+	cases := []struct {
+		path         string
+		token        string
+		expectedBody string
+	}{
+		// responses to authorized requests aren't shared between tokens
+		{"/me", "a", "Bearer a"},
+		{"/me", "b", "Bearer b"},
+		{"/me", "a", "Bearer a"},
+		// unless they are public
+		{"/shared", "a", "shared"},
+		{"/shared", "b", "shared"},
+	}
+	for _, c := range cases {
+		req, _ := New().Get("http://example.com"+c.path).Set("Authorization", "Bearer "+c.token).Request()
+		resp, err := cacher.Do(req)
+		if err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		if string(body) != c.expectedBody {
+			t.Errorf("expected %s, got %s", c.expectedBody, body)
+		}
+	}
+	if calls != 4 {
+		t.Errorf("expected %d calls, got %d", 4, calls)
+	}
+}
+
+func TestCacher_invalidation(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	var calls int
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			calls++
+			w.Header().Set("Cache-Control", "max-age=60")
+			return
+		}
+		w.Header().Set("Location", "/users/2")
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(500)
+		}
+	})
+
+	store := NewMemoryCache(0)
+	base := New().Client(client).Use(Cache(CacheOptions{Store: store}))
+	for _, path := range []string{"users/1", "users/2"} {
+		base.New().Get("http://example.com/"+path).Receive(nil, nil)
+		base.New().Get("http://example.com/"+path).Receive(nil, nil)
+	}
+	if calls != 2 || store.Len() != 2 {
+		t.Fatalf("expected 2 calls and entries, got %d %d", calls, store.Len())
+	}
+	// failed unsafe requests don't invalidate
+	base.New().Post("http://example.com/users/1?fail=1").Receive(nil, nil)
+	if store.Len() != 2 {
+		t.Errorf("expected %d entries, got %d", 2, store.Len())
+	}
+	base.New().Put("http://example.com/users/1").Receive(nil, nil)
+	if store.Len() != 0 {
+		t.Errorf("expected %d entries, got %d", 0, store.Len())
+	}
+	base.New().Get("http://example.com/users/1").Receive(nil, nil)
+	if calls != 3 {
+		t.Errorf("expected %d calls, got %d", 3, calls)
+	}
+}
+
+func TestMemoryCache(t *testing.T) {
+	cache := NewMemoryCache(2)
+	cache.Set("a", []byte("1"))
+	cache.Set("b", []byte("2"))
+	cache.Get("a")
+	cache.Set("c", []byte("3"))
+	if _, ok := cache.Get("b"); ok {
+		t.Errorf("expected the least recently used entry to be evicted")
+	}
+	cache.Set("a", []byte("4"))
+	if value, ok := cache.Get("a"); !ok || string(value) != "4" {
+		t.Errorf("expected 4, got %s", value)
+	}
+	cache.Delete("a")
+	if _, ok := cache.Get("a"); ok || cache.Len() != 1 {
+		t.Errorf("expected a to be deleted, got %d entries", cache.Len())
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "cache")
+	cache := NewDiskCache(dir)
+	if _, ok := cache.Get("GET http://a.io/"); ok {
+		t.Errorf("expected no entry")
+	}
+	cache.Set("GET http://a.io/", []byte("1"))
+	// another DiskCache for the directory shares entries
+	if value, ok := NewDiskCache(dir).Get("GET http://a.io/"); !ok || string(value) != "1" {
+		t.Errorf("expected 1, got %s", value)
+	}
+	cache.Delete("GET http://a.io/")
+	if _, ok := cache.Get("GET http://a.io/"); ok {
+		t.Errorf("expected the entry to be deleted")
+	}
+}
+
+func TestCache_streaming(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	var calls int
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		// the stream never ends
+		<-r.Context().Done()
+	})
+	mux.HandleFunc("/records", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		fmt.Fprint(w, "{}\n{}\n")
+	})
+	mux.HandleFunc("/large", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write(make([]byte, maxCacheBodyBytes+1))
+	})
+	api := New().Client(client).Base("http://example.com/").Use(Cache(CacheOptions{}))
+
+	// event streams are passed through as they are received
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	events := api.New().Get("events").ReceiveEvents(ctx)
+	if !events.Next() || events.Event().Data != "first" {
+		t.Errorf("expected the first event, got %v", events.Err())
+	}
+	events.Close()
+
+	// NDJSON and bodies over the size limit aren't stored
+	for _, path := range []string{"records", "large"} {
+		calls = 0
+		for i := 0; i < 2; i++ {
+			records := ReceiveNDJSON[FakeModel](ctx, api.New().Get(path))
+			for records.Next() {
+			}
+			api.New().Get(path).Receive(nil, nil)
+		}
+		if calls != 4 {
+			t.Errorf("%s: expected 4 calls, got %d", path, calls)
+		}
+	}
+}
+
+func TestCacher_partialBody(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	client, mux, server := testServer()
+	defer server.Close()
+	var calls int
+	mux.HandleFunc("/rates", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprint(w, "rates")
+	})
+	cacher := newTestCacher(client, clock)
+
+	// responses are stored once read to the end, not when closed early
+	req, _ := New().Get("http://example.com/rates").Request()
+	resp, _ := cacher.Do(req)
+	resp.Body.Close()
+	resp, _ = cacher.Do(req)
+	if body, _ := ioutil.ReadAll(resp.Body); string(body) != "rates" {
+		t.Errorf("expected %q, got %q", "rates", body)
+	}
+	resp.Body.Close()
+	resp, _ = cacher.Do(req)
+	resp.Body.Close()
+	if calls != 2 {
+		t.Errorf("expected 2 calls, got %d", calls)
+	}
+}
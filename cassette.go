@@ -0,0 +1,364 @@
+package nougat
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// ErrNoInteraction is returned by a replaying Cassette when no recorded
+// interaction matches a request.
+var ErrNoInteraction = errors.New("nougat: no recorded interaction matches the request")
+
+// base64Encoding marks recorded bodies which aren't valid UTF-8.
+const base64Encoding = "base64"
+
+// CassetteMode selects how a Cassette handles requests.
+type CassetteMode int
+
+const (
+	// CassetteReplay responds to requests with matching recorded
+	// interactions, without sending them.
+	CassetteReplay CassetteMode = iota
+	// CassetteRecord sends requests and records their interactions,
+	// replacing the cassette file.
+	CassetteRecord
+	// CassettePassthrough sends requests without recording or replaying.
+	CassettePassthrough
+)
+
+// CassetteOptions configures a Cassette.
+type CassetteOptions struct {
+	// Mode selects replaying, recording or passing requests through.
+	// Defaults to CassetteReplay.
+	Mode CassetteMode
+	// Doer sends requests when recording or passing through. Defaults to
+	// http.DefaultClient.
+	Doer Doer
+	// Matchers decide whether a recorded request matches a request. All
+	// must match. Defaults to MatchMethod and MatchURL.
+	Matchers []Matcher
+	// Redact lists additional header, query parameter and body field names
+	// whose values are redacted before interactions are written. Secrets
+	// such as Authorization headers, access_token parameters and Password
+	// fields are always redacted.
+	Redact []string
+}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is a request with its secrets redacted.
+type RecordedRequest struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+}
+
+// RecordedResponse is a response with its secrets redacted.
+type RecordedResponse struct {
+	StatusCode   int         `json:"status_code"`
+	Status       string      `json:"status"`
+	Header       http.Header `json:"header,omitempty"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+}
+
+// cassetteFile is the JSON document a Cassette reads and writes.
+type cassetteFile struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Matcher reports whether a recorded request matches a request. The request
+// is redacted in the same way as recorded requests.
+type Matcher func(req, recorded RecordedRequest) bool
+
+// MatchMethod matches requests with the same method.
+func MatchMethod(req, recorded RecordedRequest) bool {
+	return req.Method == recorded.Method
+}
+
+// MatchURL matches requests with the same URL, ignoring the order of query
+// parameters.
+func MatchURL(req, recorded RecordedRequest) bool {
+	return req.URL == recorded.URL
+}
+
+// MatchBody matches requests with the same body.
+func MatchBody(req, recorded RecordedRequest) bool {
+	return req.Body == recorded.Body && req.BodyEncoding == recorded.BodyEncoding
+}
+
+// MatchHeader returns a Matcher which matches requests with the same values
+// of the named headers.
+func MatchHeader(names ...string) Matcher {
+	return func(req, recorded RecordedRequest) bool {
+		for _, name := range names {
+			if fmt.Sprint(req.Header.Values(name)) != fmt.Sprint(recorded.Header.Values(name)) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Cassette is a Doer which records interactions with a server to a JSON
+// file and replays them, so tests are deterministic and don't need the
+// network. Secrets are redacted before interactions are written.
+//
+// A Cassette is safe for concurrent use.
+type Cassette struct {
+	path   string
+	opts   CassetteOptions
+	redact redactor
+
+	mu           sync.Mutex
+	interactions []Interaction
+	replayed     []bool
+}
+
+// NewCassette returns a Cassette for the file at path. When replaying, the
+// file is read and an error is returned if it can't be. When recording, the
+// file is replaced as interactions are recorded.
+func NewCassette(path string, opts CassetteOptions) (*Cassette, error) {
+	if opts.Doer == nil {
+		opts.Doer = http.DefaultClient
+	}
+	if opts.Matchers == nil {
+		opts.Matchers = []Matcher{MatchMethod, MatchURL}
+	}
+	c := &Cassette{path: path, opts: opts, redact: newRedactor(opts.Redact)}
+	if opts.Mode == CassetteReplay {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("nougat: cassette: %w", err)
+		}
+		var file cassetteFile
+		if err := json.Unmarshal(data, &file); err != nil {
+			return nil, fmt.Errorf("nougat: cassette %s: %w", path, err)
+		}
+		c.interactions = file.Interactions
+		c.replayed = make([]bool, len(file.Interactions))
+	}
+	return c, nil
+}
+
+// Interactions returns the Cassette's recorded interactions.
+func (c *Cassette) Interactions() []Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Interaction(nil), c.interactions...)
+}
+
+// Do replays, records or sends the request according to the Cassette's
+// mode.
+func (c *Cassette) Do(req *http.Request) (*http.Response, error) {
+	switch c.opts.Mode {
+	case CassetteRecord:
+		return c.record(req)
+	case CassettePassthrough:
+		return c.opts.Doer.Do(req)
+	}
+	return c.replay(req)
+}
+
+// replay returns the response of the first unreplayed matching interaction.
+// Once all matching interactions are replayed, the last is repeated.
+func (c *Cassette) replay(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	recorded := c.recordRequest(req, body)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	match := -1
+	for i, interaction := range c.interactions {
+		if !c.matches(recorded, interaction.Request) {
+			continue
+		}
+		match = i
+		if !c.replayed[i] {
+			break
+		}
+	}
+	if match < 0 {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, recorded.Method, recorded.URL)
+	}
+	c.replayed[match] = true
+	return c.interactions[match].Response.response(req)
+}
+
+// matches reports whether all of the Cassette's matchers match.
+func (c *Cassette) matches(req, recorded RecordedRequest) bool {
+	for _, match := range c.opts.Matchers {
+		if !match(req, recorded) {
+			return false
+		}
+	}
+	return true
+}
+
+// record sends the request, then records the interaction and writes the
+// cassette file.
+func (c *Cassette) record(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	out := req.Clone(req.Context())
+	if body != nil {
+		out.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	resp, err := c.opts.Doer.Do(out)
+	if err != nil {
+		return resp, err
+	}
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	interaction := Interaction{
+		Request: c.recordRequest(req, body),
+		Response: RecordedResponse{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Header:     c.redact.header(resp.Header),
+		},
+	}
+	interaction.Response.Body, interaction.Response.BodyEncoding = c.recordBody(resp.Header, respBody)
+	if interaction.Response.Body == omittedBody {
+		// the replayed body isn't encoded
+		interaction.Response.Header.Del(contentEncoding)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.interactions = append(c.interactions, interaction)
+	if err := c.save(); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// save writes the interactions to the cassette file as indented JSON.
+func (c *Cassette) save() error {
+	data, err := json.MarshalIndent(cassetteFile{Interactions: c.interactions}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(c.path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("nougat: cassette: %w", err)
+	}
+	return nil
+}
+
+// recordRequest returns the redacted form of the request.
+func (c *Cassette) recordRequest(req *http.Request, body []byte) RecordedRequest {
+	recorded := RecordedRequest{
+		Method: req.Method,
+		URL:    c.redact.url(req.URL),
+	}
+	if len(req.Header) > 0 {
+		recorded.Header = c.redact.header(req.Header)
+	}
+	recorded.Body, recorded.BodyEncoding = c.recordBody(req.Header, body)
+	return recorded
+}
+
+// recordBody returns the redacted body as a string, base64 encoded if it
+// isn't valid UTF-8. Bodies which can't be redacted, including compressed
+// bodies, are replaced by omittedBody so their secrets aren't written.
+func (c *Cassette) recordBody(header http.Header, body []byte) (string, string) {
+	if len(body) == 0 {
+		return "", ""
+	}
+	if encoding := header.Get(contentEncoding); encoding != "" && !strings.EqualFold(encoding, "identity") {
+		return omittedBody, ""
+	}
+	body, ok := c.redact.body(header.Get(contentType), body)
+	if !ok {
+		return omittedBody, ""
+	}
+	if !utf8.Valid(body) {
+		return base64.StdEncoding.EncodeToString(body), base64Encoding
+	}
+	return string(body), ""
+}
+
+// response returns the recorded response to the request.
+func (r RecordedResponse) response(req *http.Request) (*http.Response, error) {
+	body := []byte(r.Body)
+	if r.BodyEncoding == base64Encoding {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(r.Body); err != nil {
+			return nil, fmt.Errorf("nougat: cassette: %w", err)
+		}
+	}
+	header := cloneHeader(r.Header)
+	if header == nil {
+		header = make(http.Header)
+	}
+	// redaction may have changed the body length
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	status := r.Status
+	if status == "" {
+		status = fmt.Sprintf("%d %s", r.StatusCode, http.StatusText(r.StatusCode))
+	}
+	return &http.Response{
+		Status:        status,
+		StatusCode:    r.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// readRequestBody reads the request body, from a copy returned by GetBody
+// if possible, and replaces the body with the content read, closing the
+// original.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	var rc io.ReadCloser = req.Body
+	if req.GetBody != nil {
+		var err error
+		if rc, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	body, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if req.GetBody != nil {
+		// the original body isn't sent, but must be closed like a Doer would
+		req.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
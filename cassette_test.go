@@ -0,0 +1,220 @@
+package nougat
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// failingDoer fails the test if a request is sent.
+func failingDoer(t *testing.T) Doer {
+	return DoerFunc(func(req *http.Request) (*http.Response, error) {
+		t.Errorf("unexpected request %s %s", req.Method, req.URL)
+		return nil, errors.New("unexpected request")
+	})
+}
+
+func TestCassette_recordReplay(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	var calls int
+	mux.HandleFunc("/stkpush", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"CheckoutRequestID":"ws_%d","access_token":"secret-token"}`, calls)
+	})
+
+	path := filepath.Join(t.TempDir(), "stkpush.json")
+	recorder, err := NewCassette(path, CassetteOptions{Mode: CassetteRecord, Doer: client})
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	base := New().Post("http://example.com/stkpush?api_key=abc").SetBasicAuth("key", "secret")
+	recorded := map[string]interface{}{}
+	for i := 0; i < 2; i++ {
+		_, err = base.New().Doer(recorder).BodyJSON(map[string]string{"Password": "p", "Amount": "1"}).Receive(&recorded, nil)
+		if err != nil {
+			t.Errorf("expected nil, got %v", err)
+		}
+	}
+	if recorded["CheckoutRequestID"] != "ws_2" || recorded["access_token"] != "secret-token" {
+		t.Errorf("expected recording to return the server response, got %v", recorded)
+	}
+
+	data, _ := ioutil.ReadFile(path)
+	for _, secret := range []string{"secret-token", `"p"`, "abc", "a2V5OnNlY3JldA=="} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("expected %s to be redacted, got %s", secret, data)
+		}
+	}
+	if !strings.Contains(string(data), "\n  \"interactions\": [") {
+		t.Errorf("expected indented JSON, got %s", data)
+	}
+	expectedRequest := RecordedRequest{
+		Method: "POST",
+		URL:    "http://example.com/stkpush?api_key=REDACTED",
+		Header: http.Header{"Authorization": {redacted}, "Content-Type": {jsonContentType}},
+		Body:   `{"Amount":"1","Password":"REDACTED"}`,
+	}
+	if interactions := recorder.Interactions(); len(interactions) != 2 || !reflect.DeepEqual(expectedRequest, interactions[0].Request) {
+		t.Errorf("expected %+v, got %+v", expectedRequest, interactions)
+	}
+
+	player, err := NewCassette(path, CassetteOptions{Doer: failingDoer(t)})
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	// interactions replay in order, then the last repeats
+	for _, expectedID := range []string{"ws_1", "ws_2", "ws_2"} {
+		replayed := map[string]interface{}{}
+		resp, err := base.New().Doer(player).BodyJSON(map[string]string{"Password": "other"}).Receive(&replayed, nil)
+		if err != nil {
+			t.Errorf("expected nil, got %v", err)
+			continue
+		}
+		if resp.StatusCode != 200 || replayed["CheckoutRequestID"] != expectedID || replayed["access_token"] != redacted {
+			t.Errorf("expected %s, got %d %v", expectedID, resp.StatusCode, replayed)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected %d calls, got %d", 2, calls)
+	}
+}
+
+func TestCassette_noInteraction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	ioutil.WriteFile(path, []byte(`{"interactions":[{"request":{"method":"GET","url":"http://a.io/foo?a=1&b=2","body":"x"},"response":{"status_code":204}}]}`), 0644)
+
+	cases := []struct {
+		opts        CassetteOptions
+		Nougat      *Nougat
+		expectedErr error
+	}{
+		{CassetteOptions{}, New().Get("http://a.io/foo?b=2&a=1"), nil},
+		{CassetteOptions{}, New().Post("http://a.io/foo?a=1&b=2"), ErrNoInteraction},
+		{CassetteOptions{}, New().Get("http://a.io/bar"), ErrNoInteraction},
+		{CassetteOptions{Matchers: []Matcher{MatchURL, MatchBody}}, New().Get("http://a.io/foo?a=1&b=2").Body(strings.NewReader("y")), ErrNoInteraction},
+		{CassetteOptions{Matchers: []Matcher{MatchURL, MatchBody}}, New().Get("http://a.io/foo?a=1&b=2").Body(strings.NewReader("x")), nil},
+		{CassetteOptions{Matchers: []Matcher{MatchHeader("X-Tenant")}}, New().Get("http://a.io/").Set("X-Tenant", "a"), ErrNoInteraction},
+	}
+	for _, c := range cases {
+		c.opts.Doer = failingDoer(t)
+		cassette, err := NewCassette(path, c.opts)
+		if err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		resp, err := c.Nougat.Doer(cassette).Receive(nil, nil)
+		if !errors.Is(err, c.expectedErr) {
+			t.Errorf("expected %v, got %v", c.expectedErr, err)
+		}
+		if c.expectedErr == nil && (resp == nil || resp.StatusCode != 204 || resp.Status != "204 No Content") {
+			t.Errorf("expected 204 response, got %v", resp)
+		}
+	}
+}
+
+func TestCassette_binaryBody(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/image", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte{0x89, 'P', 'N', 'G', 0xff})
+	})
+
+	path := filepath.Join(t.TempDir(), "image.json")
+	recorder, _ := NewCassette(path, CassetteOptions{Mode: CassetteRecord, Doer: client})
+	if _, err := New().Doer(recorder).Get("http://example.com/image").Receive(nil, nil); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if encoding := recorder.Interactions()[0].Response.BodyEncoding; encoding != base64Encoding {
+		t.Errorf("expected %s, got %s", base64Encoding, encoding)
+	}
+
+	player, _ := NewCassette(path, CassetteOptions{})
+	req, _ := New().Get("http://example.com/image").Request()
+	resp, err := player.Do(req)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "\x89PNG\xff" || resp.ContentLength != 5 {
+		t.Errorf("expected PNG body, got %q %d", body, resp.ContentLength)
+	}
+}
+
+func TestCassette_unredactableBodies(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		w.Header().Set("Content-Encoding", r.Header.Get("Content-Encoding"))
+		io.Copy(w, r.Body)
+	})
+
+	cases := []struct {
+		Nougat *Nougat
+	}{
+		{New().Post("http://example.com/soap").Set("Content-Type", "text/xml").Body(strings.NewReader("<Password>secret</Password>"))},
+		{New().Post("http://example.com/gzip").BodyJSON(map[string]string{"Password": "secret"}).CompressBody(Gzip)},
+		{New().Post("http://example.com/json").Set("Content-Type", jsonContentType).Body(strings.NewReader(`{"Password":"secret"`))},
+	}
+	for i, c := range cases {
+		path := filepath.Join(t.TempDir(), "cassette.json")
+		recorder, _ := NewCassette(path, CassetteOptions{Mode: CassetteRecord, Doer: client})
+		if _, err := c.Nougat.Doer(recorder).Receive(nil, nil); err != nil {
+			t.Errorf("%d: expected nil, got %v", i, err)
+		}
+		data, _ := ioutil.ReadFile(path)
+		if strings.Contains(string(data), "secret") || !strings.Contains(string(data), omittedBody) {
+			t.Errorf("%d: expected the bodies to be omitted, got %s", i, data)
+		}
+	}
+}
+
+func TestCassette_closesRequestBody(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	ioutil.WriteFile(path, []byte(`{"interactions":[{"request":{"method":"POST","url":"http://a.io/"},"response":{"status_code":204}}]}`), 0644)
+	player, _ := NewCassette(path, CassetteOptions{})
+
+	body := &countingBody{r: strings.NewReader("x")}
+	req, _ := http.NewRequest("POST", "http://a.io/", body)
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("x")), nil
+	}
+	if _, err := player.Do(req); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if !body.closed {
+		t.Errorf("expected the request body to be closed")
+	}
+}
+
+func TestCassette_passthrough(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/foo", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	})
+
+	path := filepath.Join(t.TempDir(), "missing.json")
+	cassette, err := NewCassette(path, CassetteOptions{Mode: CassettePassthrough, Doer: client})
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	resp, err := New().Doer(cassette).Get("http://example.com/foo").Receive(nil, nil)
+	if err != nil || resp.StatusCode != 204 {
+		t.Errorf("expected 204, got %v %v", resp, err)
+	}
+	if len(cassette.Interactions()) != 0 {
+		t.Errorf("expected no interactions, got %v", cassette.Interactions())
+	}
+	if _, err := NewCassette(path, CassetteOptions{}); err == nil {
+		t.Errorf("expected missing cassette error, got nil")
+	}
+}
@@ -0,0 +1,152 @@
+package nougat
+
+import (
+	"net/http"
+	"reflect"
+)
+
+// bodyProviderCloner is implemented by BodyProviders whose payload can be
+// copied for child Nougats.
+type bodyProviderCloner interface {
+	cloneBodyProvider() BodyProvider
+}
+
+func (p jsonBodyProvider) cloneBodyProvider() BodyProvider {
+	return jsonBodyProvider{payload: deepCopy(p.payload)}
+}
+
+func (p formBodyProvider) cloneBodyProvider() BodyProvider {
+	return formBodyProvider{payload: deepCopy(p.payload)}
+}
+
+func (p xmlBodyProvider) cloneBodyProvider() BodyProvider {
+	return xmlBodyProvider{payload: deepCopy(p.payload)}
+}
+
+func (p soapBodyProvider) cloneBodyProvider() BodyProvider {
+	return soapBodyProvider{payload: deepCopy(p.payload)}
+}
+
+func (p multipartBodyProvider) cloneBodyProvider() BodyProvider {
+	m := &Multipart{boundary: p.multipart.boundary}
+	m.parts = append(m.parts, p.multipart.parts...)
+	return multipartBodyProvider{multipart: m}
+}
+
+// cloneBodyProvider returns a copy of the body provider if it supports
+// copying, or the body provider itself.
+func cloneBodyProvider(body BodyProvider) BodyProvider {
+	if cloner, ok := body.(bodyProviderCloner); ok {
+		return cloner.cloneBodyProvider()
+	}
+	return body
+}
+
+// cloneHeader returns a copy of the header, including its value slices.
+func cloneHeader(header http.Header) http.Header {
+	headerCopy := make(http.Header, len(header))
+	for k, v := range header {
+		headerCopy[k] = append([]string(nil), v...)
+	}
+	return headerCopy
+}
+
+// clonePathParams returns a copy of the path parameters.
+func clonePathParams(params map[string]string) map[string]string {
+	if params == nil {
+		return nil
+	}
+	paramsCopy := make(map[string]string, len(params))
+	for k, v := range params {
+		paramsCopy[k] = v
+	}
+	return paramsCopy
+}
+
+// cloneValues returns a slice of deep copies of the values.
+func cloneValues(values []interface{}) []interface{} {
+	valuesCopy := make([]interface{}, len(values))
+	for i, v := range values {
+		valuesCopy[i] = deepCopy(v)
+	}
+	return valuesCopy
+}
+
+// deepCopy returns a deep copy of v. Pointers, slices, maps and exported
+// struct fields are copied recursively; unexported struct fields, channels
+// and functions are shared with the original.
+func deepCopy(v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+	return deepCopyValue(reflect.ValueOf(v), make(map[visitedPointer]reflect.Value)).Interface()
+}
+
+// visitedPointer identifies a pointer by its address and type, since a
+// pointer to a struct and to its first field have the same address.
+type visitedPointer struct {
+	addr uintptr
+	typ  reflect.Type
+}
+
+// deepCopyValue copies v, reusing the copies of pointers already visited so
+// that shared and cyclic pointers are preserved.
+func deepCopyValue(v reflect.Value, visited map[visitedPointer]reflect.Value) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return v
+		}
+		key := visitedPointer{v.Pointer(), v.Type()}
+		if c, ok := visited[key]; ok {
+			return c
+		}
+		c := reflect.New(v.Type().Elem())
+		visited[key] = c
+		c.Elem().Set(deepCopyValue(v.Elem(), visited))
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		c.Set(v)
+		for i := 0; i < v.NumField(); i++ {
+			if field := c.Field(i); field.CanSet() {
+				field.Set(deepCopyValue(v.Field(i), visited))
+			}
+		}
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopyValue(v.Index(i), visited))
+		}
+		return c
+	case reflect.Array:
+		c := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.Len(); i++ {
+			c.Index(i).Set(deepCopyValue(v.Index(i), visited))
+		}
+		return c
+	case reflect.Map:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeMapWithSize(v.Type(), v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			c.SetMapIndex(deepCopyValue(iter.Key(), visited), deepCopyValue(iter.Value(), visited))
+		}
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(deepCopyValue(v.Elem(), visited))
+		return c
+	default:
+		return v
+	}
+}
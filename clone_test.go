@@ -0,0 +1,214 @@
+package nougat
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestNew_deepCopiesHeaderValues(t *testing.T) {
+	parent := New().Add("A", "1")
+	child := parent.New()
+	// appending to a shared backing array would leak into the other header
+	parent.header["A"] = append(parent.header["A"][:1], "parent")
+	child.header["A"] = append(child.header["A"][:1], "child")
+	if expected := []string{"1", "parent"}; !reflect.DeepEqual(expected, parent.header["A"]) {
+		t.Errorf("expected %v, got %v", expected, parent.header["A"])
+	}
+	if expected := []string{"1", "child"}; !reflect.DeepEqual(expected, child.header["A"]) {
+		t.Errorf("expected %v, got %v", expected, child.header["A"])
+	}
+}
+
+func TestNew_deepCopiesQueryStructs(t *testing.T) {
+	params := &FakeParams{KindName: "recent", Count: 25}
+	parent := New().Base("http://a.io").QueryStruct(params)
+	child := parent.New()
+	params.Count = 1
+
+	req, _ := child.Request()
+	if expected := "http://a.io?count=25&kind_name=recent"; req.URL.String() != expected {
+		t.Errorf("expected %s, got %s", expected, req.URL.String())
+	}
+	req, _ = parent.Request()
+	if expected := "http://a.io?count=1&kind_name=recent"; req.URL.String() != expected {
+		t.Errorf("expected %s, got %s", expected, req.URL.String())
+	}
+}
+
+func TestNew_deepCopiesBodyProviders(t *testing.T) {
+	model := &FakeModel{Text: "note"}
+	params := &FakeParams{KindName: "recent"}
+	cases := []struct {
+		parent   *Nougat
+		mutate   func()
+		expected string
+	}{
+		{New().BodyJSON(model), func() { model.Text = "changed" }, "{\"text\":\"note\"}\n"},
+		{New().BodyForm(params), func() { params.KindName = "changed" }, "count=0&kind_name=recent"},
+	}
+	for _, c := range cases {
+		child := c.parent.New()
+		c.mutate()
+		req, _ := child.Request()
+		body, _ := ioutil.ReadAll(req.Body)
+		if string(body) != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, body)
+		}
+	}
+
+	// multipart parts added to a child don't change the parent
+	form := NewMultipart().Field("a", "1")
+	parent := New().BodyMultipart(form)
+	child := parent.New()
+	child.bodyProvider.(multipartBodyProvider).multipart.Field("b", "2")
+	if len(form.parts) != 1 {
+		t.Errorf("expected parent to keep 1 part, got %d", len(form.parts))
+	}
+}
+
+func TestNew_deepCopiesPathParams(t *testing.T) {
+	parent := New().PathParam("id", "1")
+	child := parent.New().PathParam("id", "2")
+	if parent.pathParams["id"] != "1" || child.pathParams["id"] != "2" {
+		t.Errorf("expected independent path params, got %v and %v", parent.pathParams, child.pathParams)
+	}
+}
+
+func TestClone(t *testing.T) {
+	parent := New().Base("http://a.io/").Add("A", "B").QueryStruct(paramsA)
+	clone := parent.Clone()
+	if clone == parent {
+		t.Errorf("expected a new Nougat")
+	}
+	req, _ := clone.Request()
+	if expected := "http://a.io/?limit=30"; req.URL.String() != expected || req.Header.Get("A") != "B" {
+		t.Errorf("expected %s with header A, got %s %v", expected, req.URL, req.Header)
+	}
+}
+
+type fakeNode struct {
+	Name     string
+	Next     *fakeNode
+	Tags     map[string][]string
+	Values   [2]*int
+	Any      interface{}
+	internal *int
+}
+
+func TestDeepCopy(t *testing.T) {
+	one := 1
+	node := &fakeNode{Name: "a", Tags: map[string][]string{"k": {"v"}}, Values: [2]*int{&one, &one}, Any: []int{1}, internal: &one}
+	node.Next = node
+
+	c := deepCopy(node).(*fakeNode)
+	if c == node || !reflect.DeepEqual(c, node) {
+		t.Errorf("expected an equal copy, got %+v", c)
+	}
+	// cycles and shared pointers are preserved in the copy
+	if c.Next != c || c.Values[0] != c.Values[1] {
+		t.Errorf("expected pointer structure to be preserved")
+	}
+	c.Tags["k"][0] = "changed"
+	*c.Values[0] = 2
+	c.Any.([]int)[0] = 2
+	if node.Tags["k"][0] != "v" || one != 1 || node.Any.([]int)[0] != 1 {
+		t.Errorf("mutating the copy changed the original: %+v", node)
+	}
+	// unexported fields are shared
+	if c.internal != node.internal {
+		t.Errorf("expected unexported fields to be shared")
+	}
+	if deepCopy(nil) != nil {
+		t.Errorf("expected nil")
+	}
+}
+
+type fakeInner struct {
+	Text string
+}
+
+type fakeOuter struct {
+	Inner fakeInner
+	Ref   *fakeInner
+}
+
+func TestDeepCopy_firstFieldPointer(t *testing.T) {
+	// a pointer to the first field has the same address as its struct
+	outer := &fakeOuter{Inner: fakeInner{Text: "a"}}
+	outer.Ref = &outer.Inner
+	params := []interface{}{outer, outer.Ref}
+
+	c := cloneValues(params)
+	outerCopy, innerCopy := c[0].(*fakeOuter), c[1].(*fakeInner)
+	if outerCopy == outer || !reflect.DeepEqual(outer, outerCopy) || innerCopy.Text != "a" {
+		t.Errorf("expected equal copies, got %+v and %+v", outerCopy, innerCopy)
+	}
+	innerCopy.Text = "changed"
+	if outer.Inner.Text != "a" {
+		t.Errorf("mutating the copy changed the original: %+v", outer)
+	}
+}
+
+// TestNew_concurrentChildren derives and sends requests from children of a
+// frozen parent across goroutines. Run with -race.
+func TestNew_concurrentChildren(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/users/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"text": "%s"}`, r.URL.Path)
+	})
+
+	params := &FakeParams{KindName: "recent", Count: 25}
+	parent := New().Client(client).Base("http://example.com/").
+		Add("X-Parent", "1").QueryStruct(params).PathParam("org", "o").
+		BodyJSON(&FakeModel{Text: "body"})
+
+	// children share the file of a File part, which only one may read
+	fileParent := New().Client(client).Post("http://example.com/users/upload").
+		BodyMultipart(NewMultipart().Field("kind", "avatar").File("avatar", "a.png", "image/png", strings.NewReader("png")))
+	var uploads int32
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprint(i)
+			if _, err := fileParent.New().Receive(nil, nil); err == nil {
+				atomic.AddInt32(&uploads, 1)
+			}
+			child := parent.New().Put("users/{id}").PathParam("id", id).Add("X-Parent", id).Set("X-Child", id)
+			child.header["X-Parent"][0] = "mutated"
+			child.queryStructs[0].(*FakeParams).Count = i
+
+			model := new(FakeModel)
+			if _, err := child.Receive(model, nil); err != nil {
+				t.Errorf("expected nil, got %v", err)
+			}
+			if expected := "/users/" + id; model.Text != expected {
+				t.Errorf("expected %s, got %s", expected, model.Text)
+			}
+			if _, err := parent.Request(); err != nil {
+				t.Errorf("expected nil, got %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if expected := []string{"1"}; !reflect.DeepEqual(expected, parent.header["X-Parent"]) {
+		t.Errorf("children changed the parent header, got %v", parent.header["X-Parent"])
+	}
+	if params.Count != 25 {
+		t.Errorf("children changed the parent query struct, got %d", params.Count)
+	}
+	if uploads != 1 {
+		t.Errorf("expected %d upload, got %d", 1, uploads)
+	}
+}
@@ -0,0 +1,159 @@
+package nougat
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const contentEncoding = "Content-Encoding"
+
+// Encoding is an HTTP content coding.
+type Encoding string
+
+const (
+	// Gzip is the gzip content coding (RFC 1952).
+	Gzip Encoding = "gzip"
+	// Deflate is the deflate content coding, a zlib stream (RFC 1950).
+	Deflate Encoding = "deflate"
+)
+
+// CompressBody sets the encoding the Nougat's request bodies are compressed
+// with, and their Content-Encoding header. Any BodyProvider is compressed,
+// keeping its Content-Type and whether it is replayable. Bodies which are
+// already in memory are compressed when the request is built; others are
+// compressed as they are sent. An empty encoding disables compression.
+// An unsupported encoding leaves the compression unchanged and records an
+// error (see Err()).
+func (r *Nougat) CompressBody(encoding Encoding) *Nougat {
+	switch encoding {
+	case "", Gzip, Deflate:
+		r.compression = encoding
+	default:
+		r.setErr("CompressBody", fmt.Errorf("unsupported encoding %q", encoding))
+	}
+	return r
+}
+
+// compressedBodyProvider compresses the Body of a BodyProvider.
+type compressedBodyProvider struct {
+	provider BodyProvider
+	encoding Encoding
+}
+
+func (p compressedBodyProvider) ContentType() string {
+	return p.provider.ContentType()
+}
+
+// Replayable reports whether the wrapped BodyProvider is replayable.
+func (p compressedBodyProvider) Replayable() bool {
+	replayable, ok := p.provider.(ReplayableBodyProvider)
+	return ok && replayable.Replayable()
+}
+
+// Body returns the compressed body. Bodies whose length is known are
+// compressed into a buffer, so the request's ContentLength is set, and
+// others are streamed as they are compressed.
+func (p compressedBodyProvider) Body() (io.Reader, error) {
+	body, err := p.provider.Body()
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := body.(interface{ Len() int }); ok {
+		buf := &bytes.Buffer{}
+		if err := p.compress(buf, body); err != nil {
+			return nil, err
+		}
+		return buf, nil
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(p.compress(pw, body))
+	}()
+	return pr, nil
+}
+
+// compress writes the compressed body to w, closing the body if it is an
+// io.Closer.
+func (p compressedBodyProvider) compress(w io.Writer, body io.Reader) error {
+	if closer, ok := body.(io.Closer); ok {
+		defer closer.Close()
+	}
+	var cw io.WriteCloser
+	if p.encoding == Deflate {
+		cw = zlib.NewWriter(w)
+	} else {
+		cw = gzip.NewWriter(w)
+	}
+	if _, err := io.Copy(cw, body); err != nil {
+		cw.Close()
+		return err
+	}
+	return cw.Close()
+}
+
+// decompressResponse replaces the Body of a gzip or deflate encoded response
+// with a reader of the decompressed body, and removes its Content-Encoding
+// and Content-Length. Go's http.Transport only decompresses responses when it
+// sent the Accept-Encoding header itself, not when the caller set it.
+func decompressResponse(resp *http.Response) {
+	encoding := Encoding(strings.ToLower(strings.TrimSpace(resp.Header.Get(contentEncoding))))
+	if encoding != Gzip && encoding != Deflate && encoding != "x-gzip" {
+		return
+	}
+	resp.Body = &decompressReader{body: resp.Body, encoding: encoding}
+	resp.Header.Del(contentEncoding)
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+}
+
+// decompressReader decompresses a response body on its first Read, so empty
+// bodies, such as those of HEAD requests, don't fail until they are read.
+type decompressReader struct {
+	body     io.ReadCloser
+	encoding Encoding
+	r        io.Reader
+	err      error
+}
+
+func (d *decompressReader) Read(p []byte) (int, error) {
+	if d.r == nil && d.err == nil {
+		d.r, d.err = newDecompressor(d.body, d.encoding)
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	return d.r.Read(p)
+}
+
+func (d *decompressReader) Close() error {
+	return d.body.Close()
+}
+
+// newDecompressor returns a reader decompressing r. Deflate bodies may be a
+// zlib stream, as specified, or raw deflate data, as some servers send.
+func newDecompressor(r io.Reader, encoding Encoding) (io.Reader, error) {
+	if encoding != Deflate {
+		return gzip.NewReader(r)
+	}
+	br := bufio.NewReader(r)
+	header, err := br.Peek(2)
+	if err != nil && len(header) < 2 {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	// a zlib header uses the deflate method and is a multiple of 31
+	if header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+		return zlib.NewReader(br)
+	}
+	return flate.NewReader(br), nil
+}
@@ -0,0 +1,203 @@
+package nougat
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decompress returns the body decompressed with the encoding.
+func decompress(t *testing.T, encoding string, body io.Reader) string {
+	var r io.Reader
+	var err error
+	switch encoding {
+	case "gzip":
+		r, err = gzip.NewReader(body)
+	case "deflate":
+		r, err = zlib.NewReader(body)
+	default:
+		r = body
+	}
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	return string(b)
+}
+
+func TestCompressBody(t *testing.T) {
+	cases := []struct {
+		nougat              *Nougat
+		expectedEncoding    string
+		expectedContentType string
+		expectedBody        string
+		expectedLength      bool
+		expectedGetBody     bool
+	}{
+		{New().Post("http://a.io").BodyJSON(modelA).CompressBody(Gzip), "gzip", jsonContentType, `{"text":"note","favorite_count":12}` + "\n", true, true},
+		{New().Post("http://a.io").BodyForm(paramsA).CompressBody(Deflate), "deflate", formContentType, "limit=30", true, true},
+		// streamed bodies are compressed as they are sent
+		{New().Post("http://a.io").BodyProvider(fakeBodyProvider{content: "hello"}).CompressBody(Gzip), "gzip", "text/plain", "hello", false, false},
+		{New().Post("http://a.io").BodyMultipart(NewMultipart().Field("a", "b")).CompressBody(Gzip), "gzip", "multipart/form-data", "name=\"a\"", false, true},
+		// no body or no compression
+		{New().Get("http://a.io").CompressBody(Gzip), "", "", "", true, false},
+		{New().Post("http://a.io").BodyJSON(modelA).CompressBody(Gzip).CompressBody(""), "", jsonContentType, `{"text":"note","favorite_count":12}` + "\n", true, true},
+	}
+	for i, c := range cases {
+		req, err := c.nougat.Request()
+		if err != nil {
+			t.Fatalf("%d: expected nil, got %v", i, err)
+		}
+		if encoding := req.Header.Get("Content-Encoding"); encoding != c.expectedEncoding {
+			t.Errorf("%d: expected Content-Encoding %q, got %q", i, c.expectedEncoding, encoding)
+		}
+		if contentType := req.Header.Get("Content-Type"); !strings.HasPrefix(contentType, c.expectedContentType) {
+			t.Errorf("%d: expected Content-Type %q, got %q", i, c.expectedContentType, contentType)
+		}
+		if req.Body == nil {
+			continue
+		}
+		body, _ := ioutil.ReadAll(req.Body)
+		if c.expectedLength && req.ContentLength != int64(len(body)) {
+			t.Errorf("%d: expected ContentLength %d, got %d", i, len(body), req.ContentLength)
+		}
+		if decompressed := decompress(t, c.expectedEncoding, bytes.NewReader(body)); !strings.Contains(decompressed, c.expectedBody) {
+			t.Errorf("%d: expected body containing %q, got %q", i, c.expectedBody, decompressed)
+		}
+		if (req.GetBody != nil) != c.expectedGetBody {
+			t.Errorf("%d: expected GetBody %v, got %v", i, c.expectedGetBody, req.GetBody != nil)
+		}
+		if req.GetBody != nil {
+			replay, _ := req.GetBody()
+			if replayed, _ := ioutil.ReadAll(replay); !bytes.Equal(body, replayed) {
+				t.Errorf("%d: expected replayed body %q, got %q", i, body, replayed)
+			}
+		}
+	}
+}
+
+// notifyingBodyProvider provides a streamed body which closes done when it
+// is closed.
+type notifyingBodyProvider struct {
+	done chan struct{}
+}
+
+func (p notifyingBodyProvider) ContentType() string {
+	return "text/plain"
+}
+
+func (p notifyingBodyProvider) Body() (io.Reader, error) {
+	return closeNotifier{Reader: strings.NewReader("hello"), done: p.done}, nil
+}
+
+func TestCompressBody_requestError(t *testing.T) {
+	// the compressing goroutine stops and closes the body if the request
+	// can't be built
+	done := make(chan struct{})
+	n := New().Post("http://a.io").BodyProvider(notifyingBodyProvider{done: done}).CompressBody(Gzip).Auth(staticTokenSource{err: errDown})
+	if _, err := n.Request(); err != errDown {
+		t.Errorf("expected %v, got %v", errDown, err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("expected the body to be closed")
+	}
+}
+
+func TestCompressBody_unsupported(t *testing.T) {
+	n := New().CompressBody("br")
+	if err := n.Err(); err == nil || !strings.Contains(err.Error(), `unsupported encoding "br"`) {
+		t.Errorf("expected unsupported encoding error, got %v", err)
+	}
+	if n.compression != "" {
+		t.Errorf("expected compression to be unchanged, got %q", n.compression)
+	}
+}
+
+func TestCompressBody_clone(t *testing.T) {
+	parent := New().Post("http://a.io").CompressBody(Gzip)
+	child := parent.New().BodyJSON(modelA)
+	parent.CompressBody("")
+	req, _ := child.Request()
+	if encoding := req.Header.Get("Content-Encoding"); encoding != "gzip" {
+		t.Errorf("expected %q, got %q", "gzip", encoding)
+	}
+}
+
+func TestDecompressResponse(t *testing.T) {
+	const body = `{"text": "Some text", "favorite_count": 24}`
+	var gzipped, zlibbed, raw bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	gw.Write([]byte(body))
+	gw.Close()
+	zw := zlib.NewWriter(&zlibbed)
+	zw.Write([]byte(body))
+	zw.Close()
+	fw, _ := flate.NewWriter(&raw, flate.DefaultCompression)
+	fw.Write([]byte(body))
+	fw.Close()
+
+	cases := []struct {
+		encoding string
+		body     []byte
+	}{
+		{"gzip", gzipped.Bytes()},
+		{"x-gzip", gzipped.Bytes()},
+		{"deflate", zlibbed.Bytes()},
+		// some servers send raw deflate data
+		{"Deflate", raw.Bytes()},
+		{"", []byte(body)},
+	}
+	for i, c := range cases {
+		client, mux, server := testServer()
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			if encoding := r.Header.Get("Accept-Encoding"); encoding != "gzip, deflate" {
+				t.Errorf("%d: expected Accept-Encoding %q, got %q", i, "gzip, deflate", encoding)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if c.encoding != "" {
+				w.Header().Set("Content-Encoding", c.encoding)
+			}
+			w.Write(c.body)
+		})
+		model := new(FakeModel)
+		resp, err := New().Client(client).Get("http://example.com/").Set("Accept-Encoding", "gzip, deflate").ReceiveSuccess(model)
+		if err != nil {
+			t.Errorf("%d: expected nil, got %v", i, err)
+		}
+		if model.Text != "Some text" || model.FavoriteCount != 24 {
+			t.Errorf("%d: expected decoded model, got %v", i, model)
+		}
+		if encoding := resp.Header.Get("Content-Encoding"); encoding != "" {
+			t.Errorf("%d: expected Content-Encoding to be removed, got %q", i, encoding)
+		}
+		server.Close()
+	}
+}
+
+func TestDecompressResponse_emptyBody(t *testing.T) {
+	resp := &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Encoding": {"gzip"}},
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+	}
+	decompressResponse(resp)
+	if !resp.Uncompressed || resp.ContentLength != -1 {
+		t.Errorf("expected an uncompressed response, got %v %d", resp.Uncompressed, resp.ContentLength)
+	}
+	// the body isn't read until needed
+	if err := resp.Body.Close(); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package nougat
+
+import (
+	"context"
+	"io"
+)
+
+// Context sets the context used by Request and Receive. The context controls
+// cancellation and deadlines for building the request body, sending the
+// request and decoding the response, and carries request-scoped values
+// through the Doer stack.
+// If a nil context is given, context.Background() will be used.
+func (r *Nougat) Context(ctx context.Context) *Nougat {
+	r.ctx = ctx
+	return r
+}
+
+// context returns the Nougat's context or context.Background() if none was set.
+func (r *Nougat) context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+	return r.ctx
+}
+
+// contextReader is an io.Reader which stops reading once its context is done.
+// It guards decoding for Doers which don't tie the response Body to the
+// request context the way *http.Client does.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
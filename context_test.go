@@ -0,0 +1,145 @@
+package nougat
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type contextKey string
+
+func TestContextSetter(t *testing.T) {
+	ctx := context.WithValue(context.Background(), contextKey("k"), "v")
+	cases := []struct {
+		input    context.Context
+		expected context.Context
+	}{
+		{nil, context.Background()},
+		{ctx, ctx},
+	}
+	for _, c := range cases {
+		Nougat := New().Context(c.input)
+		if Nougat.context() != c.expected {
+			t.Errorf("expected %v, got %v", c.expected, Nougat.context())
+		}
+		// child Nougats should inherit the parent context
+		if child := Nougat.New(); child.context() != c.expected {
+			t.Errorf("expected %v, got %v", c.expected, child.context())
+		}
+	}
+}
+
+func TestRequest_context(t *testing.T) {
+	ctx := context.WithValue(context.Background(), contextKey("k"), "v")
+
+	req, err := New().Context(ctx).Get("http://a.io").Request()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if req.Context() != ctx {
+		t.Errorf("expected %v, got %v", ctx, req.Context())
+	}
+
+	req, err = New().Get("http://a.io").RequestContext(ctx)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if req.Context() != ctx {
+		t.Errorf("expected %v, got %v", ctx, req.Context())
+	}
+}
+
+func TestRequestContext_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req, err := New().Post("http://a.io").BodyJSON(modelA).RequestContext(ctx)
+	if err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if req != nil {
+		t.Errorf("expected nil Request, got %+v", req)
+	}
+}
+
+func TestReceiveContext_canceled(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/foo", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("request should not have been sent")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	resp, err := New().Client(client).Get("http://example.com/foo").ReceiveContext(ctx, new(FakeModel), nil)
+	if err == nil || !strings.Contains(err.Error(), context.Canceled.Error()) {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if resp != nil {
+		t.Errorf("expected nil resp, got %v", resp)
+	}
+}
+
+// cancelingDoer returns a canned JSON response and cancels the request
+// context before returning it.
+type cancelingDoer struct {
+	cancel context.CancelFunc
+}
+
+func (d cancelingDoer) Do(req *http.Request) (*http.Response, error) {
+	d.cancel()
+	return &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(strings.NewReader(`{"text": "Some text"}`)),
+	}, nil
+}
+
+func TestDo_contextCanceledBeforeDecode(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	model := new(FakeModel)
+	resp, err := New().Doer(cancelingDoer{cancel: cancel}).Get("http://example.com/foo").ReceiveContext(ctx, model, nil)
+	if err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if resp == nil || resp.StatusCode != 200 {
+		t.Errorf("expected 200 response, got %v", resp)
+	}
+	if expected := (FakeModel{}); *model != expected {
+		t.Errorf("successV should not be populated, expected %v, got %v", expected, *model)
+	}
+}
+
+func TestReceive_usesContext(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/foo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"text": "Some text"}`)
+	})
+
+	var seen context.Context
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		seen = req.Context()
+		return client.Do(req)
+	})
+	ctx := context.WithValue(context.Background(), contextKey("k"), "v")
+
+	model := new(FakeModel)
+	_, err := New().Doer(doer).Context(ctx).Get("http://example.com/foo").Receive(model, nil)
+	if err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if seen == nil || seen.Value(contextKey("k")) != "v" {
+		t.Errorf("expected the Doer to see the Nougat context, got %v", seen)
+	}
+	if model.Text != "Some text" {
+		t.Errorf("expected %s, got %s", "Some text", model.Text)
+	}
+}
@@ -0,0 +1,482 @@
+package nougat
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// errUnterminatedQuote is returned by FromCurl for commands with an
+// unterminated quoted string.
+var errUnterminatedQuote = errors.New("unterminated quote")
+
+// CurlOptions configures the curl commands built by ToCurl and Curl.
+type CurlOptions struct {
+	// ShowSecrets disables redacting secret headers, query parameters and
+	// JSON and form body fields, such as Authorization, access_token and
+	// Password.
+	ShowSecrets bool
+	// Redact lists additional header, query parameter and body field names
+	// whose values are redacted, compared case-insensitively and ignoring
+	// '-' and '_'.
+	Redact []string
+}
+
+// Curl builds the Nougat's request (see Request()) and returns it as a curl
+// command. Secrets are redacted unless opts.ShowSecrets is set.
+func (r *Nougat) Curl(opts CurlOptions) (string, error) {
+	req, err := r.Request()
+	if err != nil {
+		return "", err
+	}
+	return ToCurl(req, opts)
+}
+
+// ToCurl returns the request as a curl command which can be pasted into a
+// POSIX shell. Secrets are redacted unless opts.ShowSecrets is set, and
+// bodies which can't be redacted, such as XML bodies, are omitted.
+//
+// A request body is read from a copy returned by the request's GetBody if
+// it is set, or else from the body itself. Either way, the original body is
+// closed and replaced with an equivalent body.
+func ToCurl(req *http.Request, opts CurlOptions) (string, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return "", err
+	}
+	redact := newRedactor(opts.Redact)
+	header := req.Header
+	rawURL := req.URL.String()
+	if !opts.ShowSecrets {
+		header = redact.header(header)
+		rawURL = redact.url(req.URL)
+		if clean, ok := redact.body(header.Get(contentType), body); ok {
+			body = clean
+		} else if len(body) > 0 {
+			body = []byte(omittedBody)
+		}
+	}
+
+	args := []string{"curl"}
+	switch {
+	case req.Method == http.MethodHead:
+		args = append(args, "--head")
+	case req.Method != "" && req.Method != http.MethodGet || body != nil:
+		method := req.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+		args = append(args, "-X", method)
+	}
+	args = append(args, shellQuote(rawURL))
+	if req.Host != "" && req.Host != req.URL.Host {
+		args = append(args, "-H", shellQuote("Host: "+req.Host))
+	}
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range header[key] {
+			args = append(args, "-H", shellQuote(key+": "+value))
+		}
+	}
+	if body != nil {
+		args = append(args, "--data-binary", shellQuote(string(body)))
+	}
+	return strings.Join(args, " "), nil
+}
+
+// shellQuote quotes s for a POSIX shell, using ANSI-C quoting for strings
+// which aren't valid UTF-8 or contain control characters.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@,+%") == "" {
+		return s
+	}
+	printable := utf8.ValidString(s) && strings.IndexFunc(s, func(r rune) bool {
+		return r < ' ' && r != '\n' && r != '\t' || r == 0x7f
+	}) < 0
+	if printable {
+		return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+	}
+	var b strings.Builder
+	b.WriteString("$'")
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c >= 0x7f:
+			fmt.Fprintf(&b, `\x%02x`, c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteString("'")
+	return b.String()
+}
+
+// stringBodyProvider provides a replayable string body with a content type.
+type stringBodyProvider struct {
+	contentType string
+	body        string
+}
+
+func (p stringBodyProvider) ContentType() string {
+	return p.contentType
+}
+
+func (p stringBodyProvider) Replayable() bool {
+	return true
+}
+
+func (p stringBodyProvider) Body() (io.Reader, error) {
+	return strings.NewReader(p.body), nil
+}
+
+// curlCommand is the request described by a curl command.
+type curlCommand struct {
+	method    string
+	rawURL    string
+	header    http.Header
+	data      []string
+	multipart *Multipart
+	user      *url.Userinfo
+	get       bool
+}
+
+// FromCurl parses a curl command, such as an example from an API's
+// documentation, into a Nougat with its method, URL, headers, body and basic
+// auth. Quoting and line continuations follow POSIX shell rules.
+//
+// Supported options are -X, -H, -d and its --data variants, -F, -u, -G,
+// -I, -A, -e, -b and --url. Options which don't change the request, such
+// as -s, -v, -L and --compressed, are ignored. Files named by -d @file are
+// read by FromCurl and files named by -F name=@file each time the body is
+// sent.
+func FromCurl(command string) (*Nougat, error) {
+	args, err := shellSplit(command)
+	if err != nil {
+		return nil, fmt.Errorf("nougat: FromCurl: %w", err)
+	}
+	if len(args) == 0 || args[0] != "curl" {
+		return nil, errors.New("nougat: FromCurl: expected a curl command")
+	}
+	c := &curlCommand{header: make(http.Header)}
+	if err := c.parse(args[1:]); err != nil {
+		return nil, fmt.Errorf("nougat: FromCurl: %w", err)
+	}
+	return c.nougat()
+}
+
+// curlValueFlags maps curl options which take a value to their long names.
+var curlValueFlags = map[string]string{
+	"-X": "--request",
+	"-H": "--header",
+	"-d": "--data",
+	"-F": "--form",
+	"-u": "--user",
+	"-A": "--user-agent",
+	"-e": "--referer",
+	"-b": "--cookie",
+	"-o": "--output",
+}
+
+// curlIgnoredFlags are curl options which don't take a value and don't
+// change the request.
+var curlIgnoredFlags = map[string]bool{
+	"-s": true, "--silent": true,
+	"-S": true, "--show-error": true,
+	"-v": true, "--verbose": true,
+	"-i": true, "--include": true,
+	"-L": true, "--location": true,
+	"-k": true, "--insecure": true,
+	"-f": true, "--fail": true,
+	"--compressed": true,
+}
+
+// parse parses the curl command arguments.
+func (c *curlCommand) parse(args []string) error {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		var value string
+		var hasValue bool
+		switch {
+		case strings.HasPrefix(arg, "--") && strings.Contains(arg, "="):
+			arg, value = splitPair(arg, "=")
+			hasValue = true
+		case len(arg) > 2 && arg[0] == '-' && arg[1] != '-':
+			if _, ok := curlValueFlags[arg[:2]]; ok {
+				arg, value = arg[:2], arg[2:]
+				hasValue = true
+			} else {
+				// combined options, e.g. -sSL
+				var flags []string
+				for _, flag := range arg[1:] {
+					flags = append(flags, "-"+string(flag))
+				}
+				args = append(args[:i:i], append(flags, args[i+1:]...)...)
+				i--
+				continue
+			}
+		}
+		if long, ok := curlValueFlags[arg]; ok {
+			arg = long
+		}
+
+		switch arg {
+		case "--request", "--header", "--data", "--data-ascii", "--data-binary", "--data-raw", "--data-urlencode",
+			"--form", "--user", "--user-agent", "--referer", "--cookie", "--output", "--url":
+			if !hasValue {
+				if i+1 >= len(args) {
+					return fmt.Errorf("option %s requires a value", arg)
+				}
+				i++
+				value = args[i]
+			}
+			if err := c.option(arg, value); err != nil {
+				return err
+			}
+		case "-G", "--get":
+			c.get = true
+		case "-I", "--head":
+			c.method = http.MethodHead
+		default:
+			switch {
+			case curlIgnoredFlags[arg]:
+			case strings.HasPrefix(arg, "-") && arg != "-":
+				return fmt.Errorf("unsupported option %s", arg)
+			case c.rawURL != "":
+				return fmt.Errorf("unexpected argument %q", arg)
+			default:
+				c.rawURL = arg
+			}
+		}
+	}
+	if c.rawURL == "" {
+		return errors.New("missing URL")
+	}
+	return nil
+}
+
+// option applies the curl option with a value.
+func (c *curlCommand) option(name, value string) error {
+	switch name {
+	case "--request":
+		c.method = strings.ToUpper(value)
+	case "--header":
+		key, val := splitPair(value, ":")
+		c.header.Add(strings.TrimSpace(key), strings.TrimSpace(val))
+	case "--data", "--data-ascii", "--data-binary":
+		if strings.HasPrefix(value, "@") {
+			data, err := ioutil.ReadFile(value[1:])
+			if err != nil {
+				return err
+			}
+			value = string(data)
+			if name != "--data-binary" {
+				value = strings.NewReplacer("\r", "", "\n", "").Replace(value)
+			}
+		}
+		c.data = append(c.data, value)
+	case "--data-raw":
+		c.data = append(c.data, value)
+	case "--data-urlencode":
+		if i := strings.Index(value, "="); i >= 0 {
+			value = value[:i+1] + url.QueryEscape(value[i+1:])
+		} else {
+			value = url.QueryEscape(value)
+		}
+		c.data = append(c.data, value)
+	case "--form":
+		if c.multipart == nil {
+			c.multipart = NewMultipart()
+		}
+		field, val := splitPair(value, "=")
+		if strings.HasPrefix(val, "@") {
+			path, fileType := val[1:], ""
+			if i := strings.Index(path, ";type="); i >= 0 {
+				path, fileType = path[:i], path[i+len(";type="):]
+			}
+			c.multipart.FilePath(field, path, fileType)
+		} else {
+			c.multipart.Field(field, val)
+		}
+	case "--user":
+		username, password := splitPair(value, ":")
+		c.user = url.UserPassword(username, password)
+	case "--user-agent":
+		c.header.Set("User-Agent", value)
+	case "--referer":
+		c.header.Set("Referer", value)
+	case "--cookie":
+		c.header.Add("Cookie", value)
+	case "--url":
+		c.rawURL = value
+	}
+	return nil
+}
+
+// nougat returns a Nougat for the parsed curl command.
+func (c *curlCommand) nougat() (*Nougat, error) {
+	if c.multipart != nil && c.data != nil {
+		return nil, errors.New("nougat: FromCurl: -F can't be combined with -d")
+	}
+	rawURL := c.rawURL
+	if !strings.Contains(rawURL, "://") {
+		// curl assumes http for URLs without a scheme
+		rawURL = "http://" + rawURL
+	}
+	data := strings.Join(c.data, "&")
+	method := c.method
+	if c.get && c.data != nil {
+		if strings.Contains(rawURL, "?") {
+			rawURL += "&" + data
+		} else {
+			rawURL += "?" + data
+		}
+		c.data = nil
+		if method == "" {
+			method = http.MethodGet
+		}
+	}
+	if method == "" {
+		method = http.MethodGet
+		if c.data != nil || c.multipart != nil {
+			method = http.MethodPost
+		}
+	}
+
+	r := New().Base(rawURL)
+	r.method = method
+	switch {
+	case c.multipart != nil:
+		r.BodyMultipart(c.multipart)
+	case c.data != nil:
+		r.BodyProvider(stringBodyProvider{contentType: formContentType, body: data})
+	}
+	if c.user != nil {
+		password, _ := c.user.Password()
+		r.SetBasicAuth(c.user.Username(), password)
+	}
+	// headers are set after the body, so a Content-Type header overrides the
+	// body's
+	for key, values := range c.header {
+		r.header.Del(key)
+		for _, value := range values {
+			r.Add(key, value)
+		}
+	}
+	return r, r.Err()
+}
+
+// splitPair splits s around the first sep, returning s and "" if sep isn't
+// present.
+func splitPair(s, sep string) (string, string) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):]
+	}
+	return s, ""
+}
+
+// shellSplit splits a command into arguments following POSIX shell quoting
+// rules, including $'...' ANSI-C quoting and backslash-newline line
+// continuations.
+func shellSplit(command string) ([]string, error) {
+	var args []string
+	var arg bytes.Buffer
+	inArg := false
+	for i := 0; i < len(command); i++ {
+		c := command[i]
+		switch {
+		case c == '\\' && i+1 < len(command):
+			i++
+			if command[i] != '\n' {
+				arg.WriteByte(command[i])
+				inArg = true
+			}
+		case c == '\'':
+			end := strings.IndexByte(command[i+1:], '\'')
+			if end < 0 {
+				return nil, errUnterminatedQuote
+			}
+			arg.WriteString(command[i+1 : i+1+end])
+			i += end + 1
+			inArg = true
+		case c == '$' && i+1 < len(command) && command[i+1] == '\'':
+			n, err := ansiCQuoted(command[i+2:], &arg)
+			if err != nil {
+				return nil, err
+			}
+			i += n + 2
+			inArg = true
+		case c == '"':
+			i++
+			for ; i < len(command) && command[i] != '"'; i++ {
+				if command[i] == '\\' && i+1 < len(command) && strings.IndexByte("\"\\$`\n", command[i+1]) >= 0 {
+					i++
+					if command[i] == '\n' {
+						continue
+					}
+				}
+				arg.WriteByte(command[i])
+			}
+			if i >= len(command) {
+				return nil, errUnterminatedQuote
+			}
+			inArg = true
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteByte(c)
+			inArg = true
+		}
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// ansiCQuoted writes the unescaped content of the $'...' string starting
+// after its opening quote to buf and returns the index of its closing quote.
+func ansiCQuoted(s string, buf *bytes.Buffer) (int, error) {
+	escapes := map[byte]byte{'n': '\n', 't': '\t', 'r': '\r', '\\': '\\', '\'': '\'', '"': '"', '0': 0}
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\'':
+			return i, nil
+		case c == '\\' && i+1 < len(s):
+			i++
+			if s[i] == 'x' && i+2 < len(s) {
+				var b byte
+				if _, err := fmt.Sscanf(s[i+1:i+3], "%02x", &b); err == nil {
+					buf.WriteByte(b)
+					i += 2
+					continue
+				}
+			}
+			if e, ok := escapes[s[i]]; ok {
+				buf.WriteByte(e)
+			} else {
+				buf.WriteByte('\\')
+				buf.WriteByte(s[i])
+			}
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return 0, errUnterminatedQuote
+}
@@ -0,0 +1,223 @@
+package nougat
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fakeCurlCredentials struct {
+	XMLName  struct{} `xml:"Credentials"`
+	Password string
+}
+
+func TestToCurl(t *testing.T) {
+	cases := []struct {
+		Nougat   *Nougat
+		opts     CurlOptions
+		expected string
+	}{
+		{New().Get("http://a.io/foo"), CurlOptions{}, "curl http://a.io/foo"},
+		{New().Head("http://a.io/foo"), CurlOptions{}, "curl --head http://a.io/foo"},
+		{New().Delete("http://a.io/foo?page=2&api_key=k"), CurlOptions{}, "curl -X DELETE 'http://a.io/foo?api_key=REDACTED&page=2'"},
+		{New().Post("http://a.io/foo").SetBasicAuth("key", "secret").BodyJSON(map[string]string{"Password": "p", "Name": "O'Neil"}), CurlOptions{},
+			`curl -X POST http://a.io/foo -H 'Authorization: REDACTED' -H 'Content-Type: application/json' --data-binary '{"Name":"O'\''Neil","Password":"REDACTED"}'`},
+		{New().Post("http://a.io/foo").SetBasicAuth("key", "secret").BodyForm(paramsA), CurlOptions{ShowSecrets: true},
+			"curl -X POST http://a.io/foo -H 'Authorization: Basic a2V5OnNlY3JldA==' -H 'Content-Type: application/x-www-form-urlencoded' --data-binary limit=30"},
+		{New().Put("http://a.io/foo").Set("X-Phone", "254700000000").BodyForm(paramsA), CurlOptions{Redact: []string{"x_phone", "limit"}},
+			"curl -X PUT http://a.io/foo -H 'Content-Type: application/x-www-form-urlencoded' -H 'X-Phone: REDACTED' --data-binary limit=REDACTED"},
+		{New().Post("http://a.io/foo").Body(strings.NewReader("a\x00\xff'\\")), CurlOptions{}, `curl -X POST http://a.io/foo --data-binary $'a\x00\xff\'\\'`},
+		// bodies which can't be redacted are omitted
+		{New().Post("http://a.io/foo").BodyXML(&fakeCurlCredentials{Password: "hunter2"}), CurlOptions{},
+			"curl -X POST http://a.io/foo -H 'Content-Type: application/xml' --data-binary " + shellQuote(omittedBody)},
+	}
+	for _, c := range cases {
+		command, err := c.Nougat.Curl(c.opts)
+		if err != nil {
+			t.Errorf("expected nil, got %v", err)
+		}
+		if command != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, command)
+		}
+	}
+}
+
+func TestToCurl_body(t *testing.T) {
+	// a body which can't be replayed is replaced after it is read
+	req, _ := http.NewRequest("POST", "http://a.io/foo", ioutil.NopCloser(strings.NewReader("hello")))
+	command, err := ToCurl(req, CurlOptions{})
+	if err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if expected := "curl -X POST http://a.io/foo --data-binary hello"; command != expected {
+		t.Errorf("expected %s, got %s", expected, command)
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	if string(body) != "hello" {
+		t.Errorf("expected body hello, got %s", body)
+	}
+
+	// a replayable body is read from a copy, and the original is closed and
+	// replaced
+	original := &countingBody{r: strings.NewReader("hello")}
+	req, _ = http.NewRequest("POST", "http://a.io/foo", original)
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader("hello")), nil
+	}
+	if command, _ := ToCurl(req, CurlOptions{}); command != "curl -X POST http://a.io/foo --data-binary hello" {
+		t.Errorf("expected the body in the command, got %s", command)
+	}
+	if !original.closed || original.read != 0 {
+		t.Errorf("expected the original body to be closed unread, got %+v", original)
+	}
+	if body, _ := ioutil.ReadAll(req.Body); string(body) != "hello" {
+		t.Errorf("expected body hello, got %s", body)
+	}
+}
+
+func TestFromCurl(t *testing.T) {
+	dir := t.TempDir()
+	dataPath := filepath.Join(dir, "data.json")
+	os.WriteFile(dataPath, []byte("{\"a\":\n1}"), 0644)
+
+	cases := []struct {
+		command        string
+		expectedMethod string
+		expectedURL    string
+		expectedHeader http.Header
+		expectedBody   string
+	}{
+		{"curl https://a.io/foo", "GET", "https://a.io/foo", http.Header{}, ""},
+		{"curl a.io/foo -sSL --compressed", "GET", "http://a.io/foo", http.Header{}, ""},
+		{"curl -I --url https://a.io/foo", "HEAD", "https://a.io/foo", http.Header{}, ""},
+		// M-Pesa style documentation example
+		{`curl -X POST 'https://sandbox.safaricom.co.ke/mpesa/stkpush/v1/processrequest' \
+			-H 'Authorization: Bearer abc' \
+			-H "Content-Type: application/json" \
+			-d '{"BusinessShortCode": 174379, "TransactionType": "CustomerPayBillOnline"}'`,
+			"POST", "https://sandbox.safaricom.co.ke/mpesa/stkpush/v1/processrequest",
+			http.Header{"Authorization": {"Bearer abc"}, "Content-Type": {"application/json"}},
+			`{"BusinessShortCode": 174379, "TransactionType": "CustomerPayBillOnline"}`},
+		{"curl -d a=1 --data b=2 --data-urlencode 'c=x y&z' https://a.io/", "POST", "https://a.io/",
+			http.Header{"Content-Type": {formContentType}}, "a=1&b=2&c=x+y%26z"},
+		{"curl -G -d page=2 'https://a.io/foo?limit=30'", "GET", "https://a.io/foo?limit=30&page=2", http.Header{}, ""},
+		{"curl -XPUT -d@" + dataPath + " https://a.io/", "PUT", "https://a.io/",
+			http.Header{"Content-Type": {formContentType}}, `{"a":1}`},
+		{"curl --data-binary @" + dataPath + " https://a.io/", "POST", "https://a.io/",
+			http.Header{"Content-Type": {formContentType}}, "{\"a\":\n1}"},
+		{"curl --data-raw @file https://a.io/", "POST", "https://a.io/",
+			http.Header{"Content-Type": {formContentType}}, "@file"},
+		{"curl -u key:secret -A nougat/1.0 -e https://b.io -b 'a=1' --header='X-Id: 1' https://a.io/", "GET", "https://a.io/",
+			http.Header{"Authorization": {"Basic a2V5OnNlY3JldA=="}, "User-Agent": {"nougat/1.0"}, "Referer": {"https://b.io"}, "Cookie": {"a=1"}, "X-Id": {"1"}}, ""},
+		{`curl -d $'line\none' -d "say \"hi\" \$x" https://a.io/`, "POST", "https://a.io/",
+			http.Header{"Content-Type": {formContentType}}, "line\none&say \"hi\" $x"},
+	}
+	for _, c := range cases {
+		n, err := FromCurl(c.command)
+		if err != nil {
+			t.Errorf("expected nil, got %v", err)
+			continue
+		}
+		req, err := n.Request()
+		if err != nil {
+			t.Errorf("expected nil, got %v", err)
+			continue
+		}
+		if req.Method != c.expectedMethod || req.URL.String() != c.expectedURL {
+			t.Errorf("expected %s %s, got %s %s", c.expectedMethod, c.expectedURL, req.Method, req.URL)
+		}
+		if !reflect.DeepEqual(c.expectedHeader, req.Header) {
+			t.Errorf("expected %v, got %v", c.expectedHeader, req.Header)
+		}
+		var body []byte
+		if req.Body != nil {
+			body, _ = ioutil.ReadAll(req.Body)
+		}
+		if string(body) != c.expectedBody {
+			t.Errorf("expected body %q, got %q", c.expectedBody, body)
+		}
+		if req.Body != nil && req.GetBody == nil {
+			t.Errorf("expected a replayable body")
+		}
+	}
+}
+
+func TestFromCurl_form(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "receipt.txt")
+	os.WriteFile(path, []byte("paid"), 0644)
+
+	n, err := FromCurl("curl -F name=receipt -F 'file=@" + path + ";type=text/plain' https://a.io/upload")
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	req, err := n.Request()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if req.Method != "POST" {
+		t.Errorf("expected POST, got %s", req.Method)
+	}
+	if err := req.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if value := req.FormValue("name"); value != "receipt" {
+		t.Errorf("expected receipt, got %s", value)
+	}
+	file, header, err := req.FormFile("file")
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	content, _ := ioutil.ReadAll(file)
+	if string(content) != "paid" || header.Filename != "receipt.txt" || header.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("expected receipt.txt, got %s %v", content, header.Header)
+	}
+}
+
+func TestFromCurl_errors(t *testing.T) {
+	cases := []struct {
+		command     string
+		expectedErr string
+	}{
+		{"wget https://a.io/", "nougat: FromCurl: expected a curl command"},
+		{"curl 'https://a.io/", "nougat: FromCurl: unterminated quote"},
+		{`curl "https://a.io/`, "nougat: FromCurl: unterminated quote"},
+		{"curl -X", "nougat: FromCurl: option --request requires a value"},
+		{"curl --proxy p https://a.io/", "nougat: FromCurl: unsupported option --proxy"},
+		{"curl -s", "nougat: FromCurl: missing URL"},
+		{"curl https://a.io/ https://b.io/", `nougat: FromCurl: unexpected argument "https://b.io/"`},
+		{"curl -d a=1 -F b=2 https://a.io/", "nougat: FromCurl: -F can't be combined with -d"},
+	}
+	for _, c := range cases {
+		n, err := FromCurl(c.command)
+		if err == nil || err.Error() != c.expectedErr {
+			t.Errorf("expected %s, got %v", c.expectedErr, err)
+		}
+		if n != nil {
+			t.Errorf("expected nil Nougat, got %v", n)
+		}
+	}
+}
+
+func TestCurl_roundTrip(t *testing.T) {
+	original := New().Patch("http://a.io/users/1?fields=name").Set("X-Tenant", "a b").BodyJSON(map[string]string{"note": "it's\n\"quoted\""})
+	command, err := original.Curl(CurlOptions{ShowSecrets: true})
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	n, err := FromCurl(command)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	expected, _ := original.Request()
+	req, _ := n.Request()
+	expectedBody, _ := ioutil.ReadAll(expected.Body)
+	body, _ := ioutil.ReadAll(req.Body)
+	if req.Method != expected.Method || req.URL.String() != expected.URL.String() || !reflect.DeepEqual(expected.Header, req.Header) || string(body) != string(expectedBody) {
+		t.Errorf("expected %v %s, got %v %s", expected, expectedBody, req, body)
+	}
+}
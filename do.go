@@ -1,21 +1,34 @@
 package nougat
 
 import (
+	"context"
 	"io"
 	"io/ioutil"
 	"net/http"
 )
 
-// Do sends an HTTP request and returns the response. Success responses (2XX)
-// are JSON decoded into the value pointed to by successV and other responses
-// are JSON decoded into the value pointed to by failureV.
+// Do sends an HTTP request through the Nougat's middleware chain and returns
+// the response. Gzip and deflate encoded responses are decompressed, even if
+// the request set its own Accept-Encoding header. Success responses (2XX)
+// are JSON decoded into the value pointed to by successV and other
+// responses are JSON decoded into the value pointed to by failureV.
 // If the status code of response is 204(no content), decoding is skipped.
+// If ErrorOnFailure is enabled, non-2XX responses return an *HTTPError.
+// Decoding is skipped and the context's error returned if the request's
+// context is done.
 // Any error sending the request or decoding the response is returned.
 func (r *Nougat) Do(req *http.Request, successV, failureV interface{}) (*http.Response, error) {
-	resp, err := r.httpClient.Do(req)
+	return r.do(req, successV, failureV, r.errorOnFailure)
+}
+
+// do implements Do, returning an *HTTPError for non-2XX responses if
+// errorOnFailure is true.
+func (r *Nougat) do(req *http.Request, successV, failureV interface{}, errorOnFailure bool) (*http.Response, error) {
+	resp, err := r.doer().Do(req)
 	if err != nil {
 		return resp, err
 	}
+	decompressResponse(resp)
 	// when err is nil, resp contains a non-nil resp.Body which must be closed
 	defer resp.Body.Close()
 
@@ -30,9 +43,38 @@ func (r *Nougat) Do(req *http.Request, successV, failureV interface{}) (*http.Re
 		return resp, nil
 	}
 
+	if errorOnFailure && !isSuccess(resp.StatusCode) {
+		decoder, _ := r.decoderFor(resp)
+		if decoder == nil {
+			// the failure body can't be decoded, but is kept in the HTTPError
+			failureV = nil
+		}
+		return resp, newHTTPError(req, resp, decoder, failureV)
+	}
+
 	// Decode from json
-	if successV != nil || failureV != nil {
-		err = decodeResponse(resp, r.responseDecoder, successV, failureV)
+	if successV != nil && isSuccess(resp.StatusCode) || failureV != nil && !isSuccess(resp.StatusCode) {
+		var decoder ResponseDecoder
+		if decoder, err = r.decoderFor(resp); err != nil {
+			return resp, err
+		}
+		err = decodeContext(req.Context(), resp, decoder, successV, failureV)
 	}
 	return resp, err
 }
+
+// decodeContext decodes the response like decodeResponse, but stops reading
+// the response Body once ctx is done.
+// Caller is responsible for closing the resp.Body.
+func decodeContext(ctx context.Context, resp *http.Response, decoder ResponseDecoder, successV, failureV interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	body := resp.Body
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{contextReader{ctx: ctx, r: body}, body}
+	defer func() { resp.Body = body }()
+	return decodeResponse(resp, decoder, successV, failureV)
+}
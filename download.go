@@ -0,0 +1,523 @@
+package nougat
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultDownloadMaxResumes = 3
+	// downloadBufferBytes is the size of the buffer bodies are copied with
+	downloadBufferBytes = 32 << 10
+	// partSuffix is the suffix of the file DownloadFile downloads into
+	partSuffix = ".part"
+	// validatorSuffix is the suffix of the file next to the ".part" file
+	// which holds the resource's validator
+	validatorSuffix = ".validator"
+)
+
+var (
+	// ErrDownloadMismatch is returned when a download's length or checksum
+	// doesn't match the expected one.
+	ErrDownloadMismatch = errors.New("nougat: download doesn't match")
+	// ErrDownloadChanged is returned when the downloaded resource changed
+	// before an interrupted download or a chunk of a parallel download
+	// could be fetched.
+	ErrDownloadChanged = errors.New("nougat: downloaded resource changed")
+	// errDownloadChunksMethod is returned for parallel downloads of requests
+	// other than GET.
+	errDownloadChunksMethod = errors.New("nougat: Download: parallel chunks need a GET request")
+)
+
+// DownloadOptions configures a download. Zero values are replaced by
+// defaults.
+type DownloadOptions struct {
+	// Progress, if set, is called after each write with the number of bytes
+	// downloaded and the total length, or -1 if it isn't known. Calls are
+	// never concurrent.
+	Progress func(downloaded, total int64)
+	// MaxResumes is the maximum number of times an interrupted transfer is
+	// resumed from the last byte received, with a Range request whose
+	// If-Range header is the resource's ETag or Last-Modified date.
+	// Transfers are only resumed for GET requests, if the server advertises
+	// Accept-Ranges: bytes. Defaults to 3. A negative value disables
+	// resuming.
+	MaxResumes int
+	// Chunks is the number of parallel Range requests a download is split
+	// into, when the server advertises Accept-Ranges: bytes and a validator
+	// in response to a HEAD request, and the destination is an io.WriterAt.
+	// Only GET requests can be split. Defaults to 1.
+	Chunks int
+	// Hash, if set, returns the hash the download's checksum is computed
+	// with, such as sha256.New.
+	Hash func() hash.Hash
+	// Checksum is the expected checksum of the download, computed with Hash.
+	Checksum []byte
+}
+
+// Download sends the request built by the Nougat with the given context and
+// streams the response body to w, without decoding it. It returns the
+// length of the downloaded content. The request is sent with the Nougat's
+// method and body, such as a POST to an export endpoint, but only GET
+// requests are resumed or split into chunks.
+//
+// Interrupted transfers are resumed (see DownloadOptions.MaxResumes). If
+// DownloadOptions.Chunks is set and w is an io.WriterAt, such as an
+// *os.File, the download may be fetched in parallel chunks. The length is
+// verified against the response's Content-Length, and the checksum against
+// DownloadOptions.Checksum if a Hash is set, returning an error wrapping
+// ErrDownloadMismatch if they differ. A parallel download is only verified
+// against its checksum if w is also an io.ReaderAt.
+//
+// Non-2XX responses return an *HTTPError. Errors sending the request aren't
+// retried, which may be done with Retrier middleware.
+func (r *Nougat) Download(ctx context.Context, w io.Writer, opts DownloadOptions) (int64, error) {
+	d, err := newDownload(ctx, r, opts)
+	if err != nil {
+		return 0, err
+	}
+	if wa, ok := w.(io.WriterAt); ok && d.opts.Chunks > 1 {
+		ra, readable := w.(io.ReaderAt)
+		if d.opts.Hash == nil || readable {
+			parallel, err := d.parallel(wa)
+			if err != nil {
+				return d.downloaded, err
+			}
+			if parallel && readable {
+				return d.downloaded, d.verify(io.NewSectionReader(ra, 0, d.downloaded), d.downloaded)
+			}
+			if parallel {
+				return d.downloaded, nil
+			}
+		}
+	}
+
+	var sum hash.Hash
+	if d.opts.Hash != nil {
+		sum = d.opts.Hash()
+		w = io.MultiWriter(w, sum)
+	}
+	n, err := d.fetch(d.ctx, w, 0, -1, nil)
+	if err != nil {
+		return n, err
+	}
+	if err = d.verifyLength(n); err == nil && sum != nil {
+		err = d.verifyChecksum(sum.Sum(nil))
+	}
+	return n, err
+}
+
+// DownloadFile downloads the response to the request built by the Nougat
+// into the file at path, like Download. The content is written to path
+// with a ".part" suffix, which is renamed to path once the download is
+// verified. It returns the length of the file.
+//
+// If a ".part" file exists, for example from an interrupted earlier
+// download, the download resumes from its end. The resource's ETag or
+// Last-Modified date is saved in a ".part.validator" file and sent in the
+// If-Range header, so a resource which has changed is downloaded again
+// from the start. A ".part" file without a validator, or from a failed
+// parallel download, is downloaded again from the start.
+func (r *Nougat) DownloadFile(ctx context.Context, path string, opts DownloadOptions) (int64, error) {
+	part := path + partSuffix
+	validatorPath := part + validatorSuffix
+	f, err := os.OpenFile(part, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	d, err := newDownload(ctx, r, opts)
+	if err != nil {
+		return 0, err
+	}
+	offset := info.Size()
+	parallel := false
+	if offset == 0 && d.opts.Chunks > 1 {
+		parallel, err = d.parallel(f)
+	}
+	if parallel && err != nil {
+		// the chunks received aren't contiguous, so the file can't be resumed
+		if truncErr := f.Truncate(0); truncErr != nil {
+			return 0, truncErr
+		}
+		return 0, err
+	}
+	if err == nil && !parallel {
+		if offset > 0 {
+			// the validator is only saved if the server supports ranges
+			if validator, _ := ioutil.ReadFile(validatorPath); len(validator) > 0 && d.ranged {
+				d.validator = string(validator)
+				d.acceptRanges = true
+				d.downloaded = offset
+			} else {
+				offset = 0
+			}
+		}
+		d.observed = func() {
+			if d.acceptRanges && d.validator != "" {
+				ioutil.WriteFile(validatorPath, []byte(d.validator), 0o644)
+			} else {
+				os.Remove(validatorPath)
+			}
+		}
+		err = d.fetchFile(f, offset)
+	}
+	if err != nil {
+		return d.downloaded, err
+	}
+	os.Remove(validatorPath)
+
+	if info, err = f.Stat(); err != nil {
+		return 0, err
+	}
+	if err = d.verify(io.NewSectionReader(f, 0, info.Size()), info.Size()); err != nil {
+		return info.Size(), err
+	}
+	if err = f.Close(); err != nil {
+		return info.Size(), err
+	}
+	return info.Size(), os.Rename(part, path)
+}
+
+// fetchFile downloads the rest of the file from offset, starting over if
+// the resource has changed.
+func (d *download) fetchFile(f *os.File, offset int64) error {
+	if err := f.Truncate(offset); err != nil {
+		return err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := d.fetch(d.ctx, f, offset, -1, func() error {
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		_, err := f.Seek(0, io.SeekStart)
+		return err
+	})
+	return err
+}
+
+// download is the state of a download.
+type download struct {
+	ctx    context.Context
+	nougat *Nougat
+	opts   DownloadOptions
+
+	// validator is the ETag or Last-Modified date sent in If-Range headers
+	validator    string
+	acceptRanges bool
+	// ranged is whether the request may be resumed or split with Range
+	// requests, which is only the case for GET requests
+	ranged bool
+	// observed, if set, is called after a full response is observed
+	observed func()
+
+	mu sync.Mutex
+	// downloaded and total are the bytes downloaded so far and the total
+	// length, or -1 if it isn't known
+	downloaded int64
+	total      int64
+}
+
+func newDownload(ctx context.Context, n *Nougat, opts DownloadOptions) (*download, error) {
+	ranged := strings.EqualFold(n.method, http.MethodGet)
+	if opts.Chunks > 1 && !ranged {
+		return nil, errDownloadChunksMethod
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if opts.MaxResumes == 0 {
+		opts.MaxResumes = defaultDownloadMaxResumes
+	}
+	if opts.Chunks <= 0 {
+		opts.Chunks = 1
+	}
+	return &download{ctx: ctx, nougat: n, opts: opts, ranged: ranged, total: -1}, nil
+}
+
+// send sends the download request for the bytes from offset up to end, or
+// the rest of the content if end is negative. A HEAD request is sent
+// without the body, to probe a GET request.
+func (d *download) send(ctx context.Context, head bool, offset, end int64) (*http.Request, *http.Response, error) {
+	n := d.nougat.New()
+	if head {
+		n.method = http.MethodHead
+		n.bodyProvider = nil
+	}
+	// byte ranges are of the encoded content, so ask for it unencoded
+	n.Set("Accept-Encoding", "identity")
+	if offset > 0 || end >= 0 {
+		byteRange := "bytes=" + strconv.FormatInt(offset, 10) + "-"
+		if end >= 0 {
+			byteRange += strconv.FormatInt(end-1, 10)
+		}
+		n.Set("Range", byteRange)
+		if d.validator != "" {
+			n.Set("If-Range", d.validator)
+		}
+	}
+	req, err := n.RequestContext(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := n.doer().Do(req)
+	return req, resp, err
+}
+
+// observe records the validator, length and range support of a full
+// response.
+func (d *download) observe(resp *http.Response) {
+	d.validator = ""
+	if etag := resp.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		d.validator = etag
+	}
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil && d.validator == "" {
+		d.validator = lastModified.UTC().Format(http.TimeFormat)
+	}
+	d.acceptRanges = d.ranged && resp.Header.Get("Accept-Ranges") == "bytes"
+	d.mu.Lock()
+	d.total = resp.ContentLength
+	d.mu.Unlock()
+	if d.observed != nil {
+		d.observed()
+	}
+}
+
+// fetch copies the content from offset up to end, or the rest of the
+// content if end is negative, to w, resuming the transfer if it is
+// interrupted. If the resource has changed, restart is called to start
+// over, or ErrDownloadChanged returned if restart is nil. It returns the
+// number of bytes written.
+func (d *download) fetch(ctx context.Context, w io.Writer, offset, end int64, restart func() error) (int64, error) {
+	start := offset
+	for resumes := 0; ; resumes++ {
+		req, resp, err := d.send(ctx, false, offset, end)
+		if err != nil {
+			return offset - start, err
+		}
+		switch {
+		case resp.StatusCode == http.StatusPartialContent:
+			first, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+			if !ok || first != offset {
+				resp.Body.Close()
+				return offset - start, fmt.Errorf("nougat: unexpected Content-Range %q for offset %d", resp.Header.Get("Content-Range"), offset)
+			}
+			d.mu.Lock()
+			d.total = total
+			d.mu.Unlock()
+		case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0 && end < 0:
+			// the content may already be complete
+			if _, total, ok := parseContentRange(resp.Header.Get("Content-Range")); ok && total == offset {
+				resp.Body.Close()
+				d.mu.Lock()
+				d.total = total
+				d.mu.Unlock()
+				return offset - start, nil
+			}
+			defer resp.Body.Close()
+			return offset - start, newHTTPError(req, resp, nil, nil)
+		case isSuccess(resp.StatusCode):
+			if offset > 0 || end >= 0 {
+				// the full content was sent, because the resource changed
+				// or the server doesn't support ranges
+				if restart == nil {
+					resp.Body.Close()
+					return offset - start, ErrDownloadChanged
+				}
+				if err := restart(); err != nil {
+					resp.Body.Close()
+					return offset - start, err
+				}
+				d.progress(-d.downloaded)
+				offset, start = 0, 0
+			}
+			d.observe(resp)
+		default:
+			defer resp.Body.Close()
+			return offset - start, newHTTPError(req, resp, nil, nil)
+		}
+
+		n, readErr, writeErr := d.copy(ctx, w, resp.Body)
+		resp.Body.Close()
+		offset += n
+		switch {
+		case writeErr != nil:
+			return offset - start, writeErr
+		case readErr == nil:
+			return offset - start, nil
+		case ctx.Err() != nil:
+			return offset - start, ctx.Err()
+		case resumes >= d.opts.MaxResumes || !d.acceptRanges || d.validator == "":
+			return offset - start, readErr
+		}
+	}
+}
+
+// copy copies the body to w, reporting progress, and returns the number of
+// bytes written and any error reading or writing.
+func (d *download) copy(ctx context.Context, w io.Writer, body io.Reader) (written int64, readErr, writeErr error) {
+	body = contextReader{ctx: ctx, r: body}
+	buf := make([]byte, downloadBufferBytes)
+	for {
+		n, err := body.Read(buf)
+		if n > 0 {
+			if _, writeErr = w.Write(buf[:n]); writeErr != nil {
+				return written, nil, writeErr
+			}
+			written += int64(n)
+			d.progress(int64(n))
+		}
+		if err == io.EOF {
+			return written, nil, nil
+		}
+		if err != nil {
+			return written, err, nil
+		}
+	}
+}
+
+// progress adds n to the bytes downloaded and reports them.
+func (d *download) progress(n int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.downloaded += n
+	if d.opts.Progress != nil {
+		d.opts.Progress(d.downloaded, d.total)
+	}
+}
+
+// parallel downloads the content in chunks into w, returning false if the
+// server doesn't support it.
+func (d *download) parallel(w io.WriterAt) (bool, error) {
+	_, resp, err := d.send(d.ctx, true, 0, -1)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.ContentLength <= 0 {
+		return false, nil
+	}
+	d.observe(resp)
+	if !d.acceptRanges || d.validator == "" {
+		return false, nil
+	}
+
+	ctx, cancel := context.WithCancel(d.ctx)
+	defer cancel()
+	total := d.total
+	chunk := (total + int64(d.opts.Chunks) - 1) / int64(d.opts.Chunks)
+	var wg sync.WaitGroup
+	errs := make([]error, d.opts.Chunks)
+	for i := range errs {
+		start, end := int64(i)*chunk, int64(i+1)*chunk
+		if end > total {
+			end = total
+		}
+		if start >= end {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, start, end int64) {
+			defer wg.Done()
+			n, err := d.fetch(ctx, io.NewOffsetWriter(w, start), start, end, nil)
+			if err == nil && n != end-start {
+				err = fmt.Errorf("%w: chunk of %d bytes, expected %d", ErrDownloadMismatch, n, end-start)
+			}
+			if err != nil {
+				errs[i] = err
+				cancel()
+			}
+		}(i, start, end)
+	}
+	wg.Wait()
+	// report the error which cancelled the other chunks
+	var canceled error
+	for _, err := range errs {
+		switch {
+		case err == nil:
+		case errors.Is(err, context.Canceled) && d.ctx.Err() == nil:
+			canceled = err
+		default:
+			return true, err
+		}
+	}
+	if canceled != nil {
+		return true, canceled
+	}
+	return true, d.verifyLength(d.downloaded)
+}
+
+// verify verifies the length and checksum of the downloaded content.
+func (d *download) verify(content io.Reader, length int64) error {
+	if err := d.verifyLength(length); err != nil || d.opts.Hash == nil {
+		return err
+	}
+	sum := d.opts.Hash()
+	if _, err := io.Copy(sum, content); err != nil {
+		return err
+	}
+	return d.verifyChecksum(sum.Sum(nil))
+}
+
+// verifyLength verifies the length of the content, if the total is known.
+func (d *download) verifyLength(length int64) error {
+	d.mu.Lock()
+	total := d.total
+	d.mu.Unlock()
+	if total >= 0 && length != total {
+		return fmt.Errorf("%w: %d bytes, expected %d", ErrDownloadMismatch, length, total)
+	}
+	return nil
+}
+
+// verifyChecksum verifies the checksum of the content, if Hash is set.
+func (d *download) verifyChecksum(sum []byte) error {
+	if d.opts.Hash != nil && !bytes.Equal(sum, d.opts.Checksum) {
+		return fmt.Errorf("%w: checksum %x, expected %x", ErrDownloadMismatch, sum, d.opts.Checksum)
+	}
+	return nil
+}
+
+// parseContentRange returns the first byte position and complete length
+// of a Content-Range header, such as "bytes 100-199/1000" or "bytes */1000".
+// The complete length is -1 if it is unknown.
+func parseContentRange(value string) (first, total int64, ok bool) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "bytes ") {
+		return 0, 0, false
+	}
+	byteRange, length := splitPair(strings.TrimSpace(value[len("bytes "):]), "/")
+	total = -1
+	if length != "*" {
+		var err error
+		if total, err = strconv.ParseInt(length, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	if byteRange == "*" {
+		return 0, total, true
+	}
+	firstPos, _ := splitPair(byteRange, "-")
+	first, err := strconv.ParseInt(firstPos, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return first, total, true
+}
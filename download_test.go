@@ -0,0 +1,391 @@
+package nougat
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var downloadModTime = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// downloadServer serves the content with Range support, recording the
+// Range and If-Range headers of each request.
+type downloadServer struct {
+	mu       sync.Mutex
+	content  []byte
+	etag     string
+	requests []string
+}
+
+func (s *downloadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, strings.TrimSpace(r.Method+" "+r.Header.Get("Range")+" "+r.Header.Get("If-Range")))
+	content, etag := s.content, s.etag
+	s.mu.Unlock()
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	http.ServeContent(w, r, "statement.pdf", downloadModTime, bytes.NewReader(content))
+}
+
+func newDownloadServer(t *testing.T, content []byte, etag string) (*Nougat, *downloadServer) {
+	client, mux, server := testServer()
+	t.Cleanup(server.Close)
+	s := &downloadServer{content: content, etag: etag}
+	mux.Handle("/statement.pdf", s)
+	return New().Client(client).Get("http://example.com/statement.pdf"), s
+}
+
+// interrupt is Middleware which fails the body of the first response after
+// n bytes.
+func interrupt(n int64) Middleware {
+	var once sync.Once
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.Do(req)
+			if err == nil && req.Method != "HEAD" {
+				once.Do(func() {
+					resp.Body = struct {
+						io.Reader
+						io.Closer
+					}{io.MultiReader(io.LimitReader(resp.Body, n), errReader{io.ErrUnexpectedEOF}), resp.Body}
+				})
+			}
+			return resp, err
+		})
+	}
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read(p []byte) (int, error) {
+	return 0, r.err
+}
+
+// sorted returns a sorted copy of the strings.
+func sorted(values []string) []string {
+	values = append([]string(nil), values...)
+	sort.Strings(values)
+	return values
+}
+
+func downloadContent() []byte {
+	return bytes.Repeat([]byte("0123456789"), 10000)
+}
+
+func TestDownload(t *testing.T) {
+	content := downloadContent()
+	sum := sha256.Sum256(content)
+	n, server := newDownloadServer(t, content, `"v1"`)
+
+	var progress []int64
+	var buf bytes.Buffer
+	written, err := n.Download(context.Background(), &buf, DownloadOptions{
+		Progress: func(downloaded, total int64) {
+			if total != int64(len(content)) {
+				t.Errorf("expected total %d, got %d", len(content), total)
+			}
+			progress = append(progress, downloaded)
+		},
+		Hash:     sha256.New,
+		Checksum: sum[:],
+	})
+	if err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if written != int64(len(content)) || !bytes.Equal(content, buf.Bytes()) {
+		t.Errorf("expected the content, got %d bytes", written)
+	}
+	if len(progress) == 0 || progress[len(progress)-1] != int64(len(content)) {
+		t.Errorf("expected progress up to %d, got %v", len(content), progress)
+	}
+	if expected := []string{"GET"}; !reflect.DeepEqual(expected, server.requests) {
+		t.Errorf("expected requests %v, got %v", expected, server.requests)
+	}
+
+	// the checksum is verified
+	buf.Reset()
+	_, err = n.Download(context.Background(), &buf, DownloadOptions{Hash: sha256.New, Checksum: []byte("wrong")})
+	if !errors.Is(err, ErrDownloadMismatch) {
+		t.Errorf("expected ErrDownloadMismatch, got %v", err)
+	}
+}
+
+func TestDownload_resume(t *testing.T) {
+	content := downloadContent()
+	cases := []struct {
+		etag             string
+		expectedRequests []string
+	}{
+		{`"v1"`, []string{"GET", `GET bytes=30000- "v1"`}},
+		// weak ETags can't be used in If-Range
+		{`W/"v1"`, []string{"GET", "GET bytes=30000- Fri, 02 Jan 2026 03:04:05 GMT"}},
+	}
+	for i, c := range cases {
+		n, server := newDownloadServer(t, content, c.etag)
+		var buf bytes.Buffer
+		written, err := n.Use(interrupt(30000)).Download(context.Background(), &buf, DownloadOptions{})
+		if err != nil {
+			t.Errorf("%d: expected nil, got %v", i, err)
+		}
+		if written != int64(len(content)) || !bytes.Equal(content, buf.Bytes()) {
+			t.Errorf("%d: expected the content, got %d bytes", i, written)
+		}
+		if !reflect.DeepEqual(c.expectedRequests, server.requests) {
+			t.Errorf("%d: expected requests %v, got %v", i, c.expectedRequests, server.requests)
+		}
+	}
+}
+
+func TestDownload_resumeFailures(t *testing.T) {
+	content := downloadContent()
+
+	// resuming is disabled
+	n, _ := newDownloadServer(t, content, `"v1"`)
+	if _, err := n.Use(interrupt(30000)).Download(context.Background(), ioutil.Discard, DownloadOptions{MaxResumes: -1}); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+
+	// the resource changed before resuming
+	n, server := newDownloadServer(t, content, `"v1"`)
+	changing := func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.Do(req)
+			server.mu.Lock()
+			server.etag = `"v2"`
+			server.mu.Unlock()
+			return resp, err
+		})
+	}
+	if _, err := n.Use(interrupt(30000), changing).Download(context.Background(), ioutil.Discard, DownloadOptions{}); err != ErrDownloadChanged {
+		t.Errorf("expected %v, got %v", ErrDownloadChanged, err)
+	}
+}
+
+func TestDownload_failures(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "no such statement", 404)
+	})
+	short := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, ContentLength: 10, Body: ioutil.NopCloser(strings.NewReader("abc")), Request: req}, nil
+	})
+
+	var httpErr *HTTPError
+	if _, err := New().Client(client).Get("http://example.com/missing").Download(context.Background(), ioutil.Discard, DownloadOptions{}); !errors.As(err, &httpErr) || httpErr.StatusCode != 404 {
+		t.Errorf("expected a 404 *HTTPError, got %v", err)
+	}
+	if _, err := New().Doer(short).Get("http://a.io/").Download(context.Background(), ioutil.Discard, DownloadOptions{}); !errors.Is(err, ErrDownloadMismatch) {
+		t.Errorf("expected ErrDownloadMismatch, got %v", err)
+	}
+}
+
+func TestDownload_post(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	var requests []string
+	mux.HandleFunc("/exports", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.Header.Get("Range")+strings.TrimSpace(string(body)))
+		w.Header().Set("Accept-Ranges", "bytes")
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprint(w, "date,amount\n")
+	})
+	n := New().Client(client).Post("http://example.com/exports").BodyJSON(map[string]string{"month": "march"})
+
+	// the request is sent with its method and body
+	var buf bytes.Buffer
+	if written, err := n.New().Download(context.Background(), &buf, DownloadOptions{}); err != nil || written != 12 || buf.String() != "date,amount\n" {
+		t.Errorf("expected the export, got %q and %v", buf.String(), err)
+	}
+	// and isn't resumed
+	if _, err := n.New().Use(interrupt(4)).Download(context.Background(), &buf, DownloadOptions{}); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+	expected := []string{`POST {"month":"march"}`, `POST {"month":"march"}`}
+	if !reflect.DeepEqual(expected, requests) {
+		t.Errorf("expected requests %v, got %v", expected, requests)
+	}
+	// or split into chunks
+	path := filepath.Join(t.TempDir(), "export.csv")
+	if _, err := n.New().DownloadFile(context.Background(), path, DownloadOptions{Chunks: 4}); err == nil || !strings.Contains(err.Error(), "GET") {
+		t.Errorf("expected an error, got %v", err)
+	}
+}
+
+func TestDownloadFile_parallel(t *testing.T) {
+	content := downloadContent()
+	sum := sha256.Sum256(content)
+	n, server := newDownloadServer(t, content, `"v1"`)
+	path := filepath.Join(t.TempDir(), "statement.pdf")
+
+	var mu sync.Mutex
+	var last int64
+	written, err := n.DownloadFile(context.Background(), path, DownloadOptions{
+		Chunks: 4,
+		Progress: func(downloaded, total int64) {
+			mu.Lock()
+			last = downloaded
+			mu.Unlock()
+		},
+		Hash:     sha256.New,
+		Checksum: sum[:],
+	})
+	if err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if written != int64(len(content)) || last != int64(len(content)) {
+		t.Errorf("expected %d bytes, got %d and progress %d", len(content), written, last)
+	}
+	if data, _ := ioutil.ReadFile(path); !bytes.Equal(content, data) {
+		t.Errorf("expected the content, got %d bytes", len(data))
+	}
+	if _, err := os.Stat(path + ".part"); !os.IsNotExist(err) {
+		t.Errorf("expected the part file to be renamed, got %v", err)
+	}
+	expected := []string{`GET bytes=0-24999 "v1"`, `GET bytes=25000-49999 "v1"`, `GET bytes=50000-74999 "v1"`, `GET bytes=75000-99999 "v1"`, "HEAD"}
+	if !reflect.DeepEqual(expected, sorted(server.requests)) {
+		t.Errorf("expected requests %v, got %v", expected, server.requests)
+	}
+}
+
+func TestDownloadFile_resume(t *testing.T) {
+	content := downloadContent()
+	cases := []struct {
+		validator        string
+		expectedRequests []string
+	}{
+		// the part file is resumed if the resource wasn't modified
+		{"Fri, 02 Jan 2026 03:04:05 GMT", []string{"GET bytes=40000- Fri, 02 Jan 2026 03:04:05 GMT"}},
+		// otherwise it is downloaded again
+		{"Fri, 02 Jan 2026 02:04:05 GMT", []string{"GET bytes=40000- Fri, 02 Jan 2026 02:04:05 GMT"}},
+		// without a validator, it can't be resumed
+		{"", []string{"GET"}},
+	}
+	for i, c := range cases {
+		n, server := newDownloadServer(t, content, "")
+		path := filepath.Join(t.TempDir(), "statement.pdf")
+		ioutil.WriteFile(path+".part", content[:40000], 0o644)
+		if c.validator != "" {
+			ioutil.WriteFile(path+".part.validator", []byte(c.validator), 0o644)
+		}
+
+		written, err := n.DownloadFile(context.Background(), path, DownloadOptions{})
+		if err != nil {
+			t.Errorf("%d: expected nil, got %v", i, err)
+		}
+		if data, _ := ioutil.ReadFile(path); written != int64(len(content)) || !bytes.Equal(content, data) {
+			t.Errorf("%d: expected the content, got %d bytes", i, len(data))
+		}
+		if !reflect.DeepEqual(c.expectedRequests, server.requests) {
+			t.Errorf("%d: expected requests %v, got %v", i, c.expectedRequests, server.requests)
+		}
+		if _, err := os.Stat(path + ".part.validator"); !os.IsNotExist(err) {
+			t.Errorf("%d: expected the validator file to be removed, got %v", i, err)
+		}
+	}
+}
+
+func TestDownloadFile_interrupted(t *testing.T) {
+	content := downloadContent()
+	n, server := newDownloadServer(t, content, `"v1"`)
+	path := filepath.Join(t.TempDir(), "statement.pdf")
+
+	// the validator is saved with the part file, so it can be resumed later
+	if _, err := n.New().Use(interrupt(30000)).DownloadFile(context.Background(), path, DownloadOptions{MaxResumes: -1}); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+	if info, err := os.Stat(path + ".part"); err != nil || info.Size() != 30000 {
+		t.Errorf("expected a 30000 byte part file, got %v", info)
+	}
+	if validator, _ := ioutil.ReadFile(path + ".part.validator"); string(validator) != `"v1"` {
+		t.Errorf("expected validator %q, got %q", `"v1"`, validator)
+	}
+	written, err := n.DownloadFile(context.Background(), path, DownloadOptions{})
+	if err != nil || written != int64(len(content)) {
+		t.Errorf("expected %d bytes, got %d and %v", len(content), written, err)
+	}
+	if expected := []string{"GET", `GET bytes=30000- "v1"`}; !reflect.DeepEqual(expected, server.requests) {
+		t.Errorf("expected requests %v, got %v", expected, server.requests)
+	}
+}
+
+func TestDownloadFile_parallelFailure(t *testing.T) {
+	content := downloadContent()
+	n, _ := newDownloadServer(t, content, `"v1"`)
+	path := filepath.Join(t.TempDir(), "statement.pdf")
+	var once sync.Once
+	failing := func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Header.Get("Range") == "bytes=0-24999" {
+				failed := false
+				once.Do(func() { failed = true })
+				if failed {
+					return &http.Response{StatusCode: 500, Body: ioutil.NopCloser(strings.NewReader("")), Request: req}, nil
+				}
+			}
+			return next.Do(req)
+		})
+	}
+
+	// the chunks received aren't resumed, since the part file has gaps
+	var httpErr *HTTPError
+	if _, err := n.New().Use(failing).DownloadFile(context.Background(), path, DownloadOptions{Chunks: 4}); !errors.As(err, &httpErr) || httpErr.StatusCode != 500 {
+		t.Errorf("expected a 500 *HTTPError, got %v", err)
+	}
+	if info, err := os.Stat(path + ".part"); err != nil || info.Size() != 0 {
+		t.Errorf("expected an empty part file, got %v", info)
+	}
+	written, err := n.New().Use(failing).DownloadFile(context.Background(), path, DownloadOptions{Chunks: 4})
+	if err != nil || written != int64(len(content)) {
+		t.Errorf("expected %d bytes, got %d and %v", len(content), written, err)
+	}
+	if data, _ := ioutil.ReadFile(path); !bytes.Equal(content, data) {
+		t.Errorf("expected the content, got %d bytes", len(data))
+	}
+
+	// errors sending the HEAD request are returned
+	if _, err := New().Doer(DoerFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errDown
+	})).Get("http://a.io/").DownloadFile(context.Background(), filepath.Join(t.TempDir(), "x"), DownloadOptions{Chunks: 4}); err != errDown {
+		t.Errorf("expected %v, got %v", errDown, err)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	cases := []struct {
+		value         string
+		expectedFirst int64
+		expectedTotal int64
+		expectedOK    bool
+	}{
+		{"bytes 100-199/1000", 100, 1000, true},
+		{"bytes 0-99/*", 0, -1, true},
+		{"bytes */1000", 0, 1000, true},
+		{"items 0-1/2", 0, 0, false},
+		{"bytes x-1/2", 0, 0, false},
+		{"bytes 0-1/x", 0, 0, false},
+	}
+	for _, c := range cases {
+		first, total, ok := parseContentRange(c.value)
+		if first != c.expectedFirst || total != c.expectedTotal || ok != c.expectedOK {
+			t.Errorf("%s: expected %d %d %v, got %d %d %v", c.value, c.expectedFirst, c.expectedTotal, c.expectedOK, first, total, ok)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package nougat
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// errNilBody is recorded when a body setter is given a nil body.
+var errNilBody = errors.New("nil body")
+
+// maxErrorBodySnippet bounds the number of response body bytes kept in an
+// HTTPError.
+const maxErrorBodySnippet = 512
+
+// APIError is a common JSON error response body, which can be decoded as
+// a failureV.
+type APIError struct {
+	Message string `json:"message"`
+	Code    int    `json:"code"`
+}
+
+func (e APIError) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+// HTTPError is returned for non-2XX responses when ErrorOnFailure is
+// enabled. Use errors.As to inspect it.
+type HTTPError struct {
+	// Method is the request method.
+	Method string
+	// URL is the request URL with its password and secret query parameter
+	// values redacted.
+	URL string
+	// StatusCode is the response status code.
+	StatusCode int
+	// Status is the response status line, e.g. "404 Not Found".
+	Status string
+	// Header is the response header.
+	Header http.Header
+	// Body holds up to the first 512 bytes of the response body.
+	Body []byte
+	// Failure is the failureV passed to Do or Receive, populated with the
+	// decoded response body. It is nil if no failureV was given or if
+	// decoding failed.
+	Failure interface{}
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("nougat: %s %s: %s", e.Method, e.URL, e.Status)
+}
+
+// Unwrap returns the Failure if it is an error, so that errors.As can match
+// a failureV type, such as *APIError, which implements error.
+func (e *HTTPError) Unwrap() error {
+	if err, ok := e.Failure.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// ErrorOnFailure sets whether Do and Receive return an *HTTPError for
+// non-2XX responses. The response body is still decoded into failureV, which
+// is attached to the error.
+// By default, non-2XX responses don't produce an error.
+func (r *Nougat) ErrorOnFailure(enable bool) *Nougat {
+	r.errorOnFailure = enable
+	return r
+}
+
+// newHTTPError returns an HTTPError for the response to req, decoding the
+// response Body into failureV if it is non-nil.
+// Caller is responsible for closing the resp.Body.
+func newHTTPError(req *http.Request, resp *http.Response, decoder ResponseDecoder, failureV interface{}) *HTTPError {
+	status := resp.Status
+	if status == "" {
+		status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+	}
+	httpErr := &HTTPError{
+		Method:     req.Method,
+		URL:        redactURL(req.URL),
+		StatusCode: resp.StatusCode,
+		Status:     status,
+		Header:     resp.Header,
+	}
+
+	// keep a snippet of the body read while decoding, topped up afterwards
+	snippet := &snippetWriter{max: maxErrorBodySnippet}
+	body := resp.Body
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(body, snippet), body}
+	defer func() { resp.Body = body }()
+
+	if failureV != nil {
+		if err := decodeContext(req.Context(), resp, decoder, nil, failureV); err == nil {
+			httpErr.Failure = failureV
+		}
+	}
+	if remaining := snippet.max - snippet.buf.Len(); remaining > 0 && req.Context().Err() == nil {
+		io.CopyN(ioutil.Discard, resp.Body, int64(remaining))
+	}
+	httpErr.Body = snippet.buf.Bytes()
+	return httpErr
+}
+
+// snippetWriter keeps the first max bytes written to it.
+type snippetWriter struct {
+	buf bytes.Buffer
+	max int
+}
+
+func (w *snippetWriter) Write(p []byte) (int, error) {
+	if remaining := w.max - w.buf.Len(); remaining > 0 {
+		if len(p) > remaining {
+			w.buf.Write(p[:remaining])
+		} else {
+			w.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// Err returns the first error recorded while configuring the Nougat, such as
+// a Path which could not be parsed or a nil body, or nil. The error names
+// the setter which caused it. Request and Receive return the error instead
+// of building a request. Child Nougats created with New inherit the error.
+func (r *Nougat) Err() error {
+	return r.err
+}
+
+// setErr records the error of the named setter, unless an error was already
+// recorded.
+func (r *Nougat) setErr(setter string, err error) {
+	if r.err == nil {
+		r.err = fmt.Errorf("nougat: %s: %w", setter, err)
+	}
+}
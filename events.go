@@ -0,0 +1,300 @@
+package nougat
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	eventStreamContentType = "text/event-stream"
+	lastEventID            = "Last-Event-ID"
+	// defaultEventRetry is the reconnection time until the server sets one
+	defaultEventRetry = 3 * time.Second
+	// maxEventLineBytes is the longest event stream line read
+	maxEventLineBytes = 1 << 20
+)
+
+// Event is a Server-Sent Event.
+type Event struct {
+	// ID is the event's id, or the last id the stream sent before it.
+	ID string
+	// Event is the event type, "message" unless the server set one.
+	Event string
+	// Data is the event's data lines, joined by newlines.
+	Data string
+	// Retry is the reconnection time the server sent with the event, or 0.
+	Retry time.Duration
+}
+
+// EventStream iterates over the Server-Sent Events of a text/event-stream
+// response. For example,
+//
+//	events := api.New().Get("notifications").ReceiveEvents(ctx)
+//	defer events.Close()
+//	for events.Next() {
+//		event := events.Event()
+//		...
+//	}
+//	if err := events.Err(); err != nil {
+//		...
+//	}
+//
+// When the connection drops, the stream reconnects after the retry interval
+// sent by the server (3s by default), sending the Last-Event-ID header so
+// the server can resume after the last event received. A 204 No Content
+// response ends the stream. Non-2XX responses end it with an *HTTPError and
+// other media types with an *UnsupportedMediaTypeError.
+//
+// The response body is read as events are requested and is never drained,
+// so the stream ends only when the server ends it, its context is done or
+// Close is called.
+type EventStream struct {
+	ctx    context.Context
+	nougat *Nougat
+
+	lastEventID string
+	retry       time.Duration
+	connected   bool
+	scanner     *bufio.Scanner
+	// first is set until the first line of a connection is read
+	first bool
+	event Event
+	done  bool
+	err   error
+
+	mu     sync.Mutex
+	body   io.ReadCloser
+	closed bool
+	// sleep waits for d or until ctx is done
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// ReceiveEvents returns an EventStream of the Server-Sent Events sent in
+// response to the request built by the Nougat, sent with the given context.
+// The request has Accept: text/event-stream and Cache-Control: no-cache
+// headers. The stream bypasses the Nougat's response decoders.
+func (r *Nougat) ReceiveEvents(ctx context.Context) *EventStream {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &EventStream{
+		ctx:         ctx,
+		nougat:      r.New(),
+		lastEventID: r.header.Get(lastEventID),
+		retry:       defaultEventRetry,
+		sleep:       sleepContext,
+	}
+}
+
+// Stream is ReceiveEvents with the Nougat's context (see Context).
+func (r *Nougat) Stream() *EventStream {
+	return r.ReceiveEvents(r.context())
+}
+
+// Next advances to the next event, connecting or reconnecting as needed.
+// It returns false when the stream has ended, was closed, or on error.
+func (s *EventStream) Next() bool {
+	for !s.done && s.err == nil && !s.isClosed() {
+		if s.scanner == nil {
+			if s.connected {
+				if s.err = s.sleep(s.ctx, s.retry); s.err != nil {
+					return false
+				}
+			}
+			s.err = s.connect()
+			continue
+		}
+		if event, ok := s.read(); ok {
+			s.event = event
+			return true
+		}
+		// the connection ended, so reconnect unless the context is done
+		s.closeBody()
+		if s.err == nil {
+			s.err = s.ctx.Err()
+		}
+	}
+	return false
+}
+
+// Event returns the current event.
+func (s *EventStream) Event() Event {
+	return s.event
+}
+
+// LastEventID returns the last event id sent by the server, which is sent
+// in the Last-Event-ID header when reconnecting.
+func (s *EventStream) LastEventID() string {
+	return s.lastEventID
+}
+
+// Err returns the error which ended the stream, or the context's error if
+// it was cancelled. Closing the stream isn't an error.
+func (s *EventStream) Err() error {
+	if s.isClosed() {
+		return nil
+	}
+	return s.err
+}
+
+// Close closes the stream's connection and ends the stream. It may be called
+// concurrently with Next to stop waiting for events.
+func (s *EventStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.body != nil {
+		return s.body.Close()
+	}
+	return nil
+}
+
+func (s *EventStream) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// closeBody closes the connection's body so the stream reconnects.
+func (s *EventStream) closeBody() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.body != nil {
+		s.body.Close()
+		s.body = nil
+	}
+	s.scanner = nil
+}
+
+// connect sends the request for the stream. Errors sending the first
+// request are returned, while later ones are left to reconnect.
+func (s *EventStream) connect() error {
+	n := s.nougat.New().Set(accept, eventStreamContentType).Set("Cache-Control", "no-cache")
+	if s.lastEventID != "" {
+		n.Set(lastEventID, s.lastEventID)
+	}
+	req, err := n.RequestContext(s.ctx)
+	if err != nil {
+		return err
+	}
+	resp, err := n.doer().Do(req)
+	if err != nil {
+		if !s.connected || s.ctx.Err() != nil {
+			return err
+		}
+		return nil
+	}
+	decompressResponse(resp)
+	if resp.StatusCode == http.StatusNoContent {
+		resp.Body.Close()
+		s.done = true
+		return nil
+	}
+	if !isSuccess(resp.StatusCode) {
+		defer resp.Body.Close()
+		return newHTTPError(req, resp, nil, nil)
+	}
+	if mediaType := normalizeMediaType(resp.Header.Get(contentType)); mediaType != eventStreamContentType {
+		resp.Body.Close()
+		return &UnsupportedMediaTypeError{MediaType: mediaType, StatusCode: resp.StatusCode}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return resp.Body.Close()
+	}
+	s.body = resp.Body
+	s.scanner = bufio.NewScanner(contextReader{ctx: s.ctx, r: resp.Body})
+	s.scanner.Buffer(nil, maxEventLineBytes)
+	s.scanner.Split(scanEventLines)
+	s.connected, s.first = true, true
+	return nil
+}
+
+// read parses lines until an event is dispatched, returning false when the
+// connection ends. An event which is incomplete when it ends is discarded.
+func (s *EventStream) read() (Event, bool) {
+	var data strings.Builder
+	var hasData bool
+	event := Event{}
+	for s.scanner.Scan() {
+		line := s.scanner.Text()
+		if s.first {
+			line = strings.TrimPrefix(line, "\ufeff")
+			s.first = false
+		}
+		if line == "" {
+			if !hasData {
+				// events without data aren't dispatched
+				event = Event{}
+				continue
+			}
+			event.ID, event.Data = s.lastEventID, strings.TrimSuffix(data.String(), "\n")
+			if event.Event == "" {
+				event.Event = "message"
+			}
+			return event, true
+		}
+		if strings.HasPrefix(line, ":") {
+			// a comment, such as a keep-alive
+			continue
+		}
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				s.lastEventID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseUint(value, 10, 32); err == nil {
+				s.retry = time.Duration(ms) * time.Millisecond
+				event.Retry = s.retry
+			}
+		}
+	}
+	if err := s.scanner.Err(); err == bufio.ErrTooLong {
+		s.err = err
+	}
+	return Event{}, false
+}
+
+// scanEventLines is a bufio.SplitFunc for lines ending in CRLF, LF or CR.
+// A final line without an ending is dropped.
+func scanEventLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	i := bytes.IndexAny(data, "\r\n")
+	switch {
+	case i < 0:
+		if atEOF {
+			return len(data), nil, nil
+		}
+		return 0, nil, nil
+	case data[i] == '\n':
+		return i + 1, data[:i], nil
+	case i+1 < len(data):
+		if data[i+1] == '\n' {
+			return i + 2, data[:i], nil
+		}
+		return i + 1, data[:i], nil
+	case atEOF:
+		return i + 1, data[:i], nil
+	}
+	// a CR at the end of data may be followed by a LF
+	return 0, nil, nil
+}
@@ -0,0 +1,180 @@
+package nougat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// eventServer responds to each connection with the next stream, or 204 No
+// Content once they are used up, recording the Last-Event-ID headers.
+func eventServer(t *testing.T, streams ...string) (*Nougat, *[]string, func()) {
+	client, mux, server := testServer()
+	var lastEventIDs []string
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		if accept := r.Header.Get("Accept"); accept != "text/event-stream" {
+			t.Errorf("expected Accept %q, got %q", "text/event-stream", accept)
+		}
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		if len(lastEventIDs) > len(streams) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		fmt.Fprint(w, streams[len(lastEventIDs)-1])
+	})
+	return New().Client(client).Get("http://example.com/events"), &lastEventIDs, server.Close
+}
+
+func TestEventStream(t *testing.T) {
+	n, lastEventIDs, closeServer := eventServer(t,
+		"\ufeff: keep-alive\n\ndata: hello\n\nevent: update\ndata:{\"a\":1}\ndata: line 2\nid: 1\n\n"+
+			"retry: 1500\n\nid\ndata\n\ndata: crlf\r\nid: 2\r\n\r\ndata: cr\rid: 3\r\rdata: incomplete\n",
+		"data: resumed\n\n",
+	)
+	defer closeServer()
+	var waits []time.Duration
+	events := n.ReceiveEvents(context.Background())
+	events.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	var received []Event
+	for events.Next() {
+		received = append(received, events.Event())
+	}
+	if err := events.Err(); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	expected := []Event{
+		{Event: "message", Data: "hello"},
+		{ID: "1", Event: "update", Data: "{\"a\":1}\nline 2"},
+		{Event: "message", Data: ""},
+		{ID: "2", Event: "message", Data: "crlf"},
+		{ID: "3", Event: "message", Data: "cr"},
+		{ID: "3", Event: "message", Data: "resumed"},
+	}
+	if !reflect.DeepEqual(expected, received) {
+		t.Errorf("expected %v, got %v", expected, received)
+	}
+	// reconnections wait for the retry interval and resume from the last id
+	if expected := []time.Duration{1500 * time.Millisecond, 1500 * time.Millisecond}; !reflect.DeepEqual(expected, waits) {
+		t.Errorf("expected waits %v, got %v", expected, waits)
+	}
+	if expected := []string{"", "3", "3"}; !reflect.DeepEqual(expected, *lastEventIDs) {
+		t.Errorf("expected Last-Event-IDs %v, got %v", expected, *lastEventIDs)
+	}
+}
+
+func TestEventStream_retryField(t *testing.T) {
+	n, _, closeServer := eventServer(t, "retry: 250\ndata: a\n\nretry: x\ndata: b\n\n")
+	defer closeServer()
+	events := n.Set("Last-Event-ID", "7").Stream()
+	events.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+	var received []Event
+	for events.Next() {
+		received = append(received, events.Event())
+	}
+	expected := []Event{
+		{ID: "7", Event: "message", Data: "a", Retry: 250 * time.Millisecond},
+		{ID: "7", Event: "message", Data: "b"},
+	}
+	if !reflect.DeepEqual(expected, received) {
+		t.Errorf("expected %v, got %v", expected, received)
+	}
+}
+
+func TestEventStream_errors(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/failure", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(500)
+		fmt.Fprint(w, "down")
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, "{}")
+	})
+	failing := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		return nil, errDown
+	})
+
+	cases := []struct {
+		nougat *Nougat
+		check  func(err error) bool
+	}{
+		{New().Client(client).Get("http://example.com/failure"), func(err error) bool {
+			var httpErr *HTTPError
+			return errors.As(err, &httpErr) && httpErr.StatusCode == 500 && string(httpErr.Body) == "down"
+		}},
+		{New().Client(client).Get("http://example.com/json"), func(err error) bool {
+			return errors.Is(err, ErrUnsupportedMediaType)
+		}},
+		// the first connection isn't retried
+		{New().Doer(failing).Get("http://example.com/events"), func(err error) bool {
+			return err == errDown
+		}},
+		{New().Get("http://example.com/{id}"), func(err error) bool {
+			return err != nil
+		}},
+	}
+	for i, c := range cases {
+		events := c.nougat.ReceiveEvents(context.Background())
+		if events.Next() {
+			t.Errorf("%d: expected no events", i)
+		}
+		if err := events.Err(); !c.check(err) {
+			t.Errorf("%d: unexpected error %v", i, err)
+		}
+	}
+}
+
+func TestEventStream_close(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		// the stream never ends
+		<-r.Context().Done()
+	})
+
+	events := New().Client(client).Get("http://example.com/events").ReceiveEvents(context.Background())
+	if !events.Next() || events.Event().Data != "first" {
+		t.Fatalf("expected the first event, got %v", events.Err())
+	}
+	time.AfterFunc(10*time.Millisecond, func() { events.Close() })
+	if events.Next() {
+		t.Errorf("expected no events after Close")
+	}
+	if err := events.Err(); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+}
+
+func TestEventStream_contextDone(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/events", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, strings.Repeat(": keep-alive\n", 3))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	events := New().Client(client).Get("http://example.com/events").ReceiveEvents(ctx)
+	if events.Next() {
+		t.Errorf("expected no events")
+	}
+	if err := events.Err(); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
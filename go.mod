@@ -1,5 +1,5 @@
 module github.com/wondenge/nougat
 
-go 1.14
+go 1.21
 
 require github.com/google/go-querystring v1.0.0
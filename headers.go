@@ -27,7 +27,7 @@ func (r *Nougat) Set(key, value string) *Nougat {
 // with the provided username and password. With HTTP Basic Authentication
 // the provided username and password are not encrypted.
 func (r *Nougat) SetBasicAuth(username, password string) *Nougat {
-	return r.Set("Authorization", "Basic "+basicAuth(username, password))
+	return r.Set(authorization, "Basic "+basicAuth(username, password))
 }
 
 // basicAuth returns the base64 encoded username:password for basic auth copied
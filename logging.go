@@ -0,0 +1,208 @@
+package nougat
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultMaxBodyBytes is the default maximum length of logged bodies.
+	defaultMaxBodyBytes = 1024
+	// maxRedactBodyBytes is the maximum length of bodies read to be
+	// redacted. Longer JSON and form bodies are omitted from logs.
+	maxRedactBodyBytes = 64 << 10
+)
+
+// omittedBody is logged in place of bodies which can't be redacted.
+const omittedBody = "(body omitted: can't be redacted)"
+
+// LogOptions configures the Log middleware.
+type LogOptions struct {
+	// Level is the level of entries for completed requests. Requests which
+	// fail without a response are logged at slog.LevelError.
+	Level slog.Level
+	// Headers enables logging request and response headers.
+	Headers bool
+	// Bodies enables logging request and response bodies, truncated to
+	// MaxBodyBytes.
+	Bodies bool
+	// MaxBodyBytes is the maximum length of logged bodies. Defaults to 1024.
+	MaxBodyBytes int
+	// Redact lists additional header, query parameter and body field names
+	// whose values are redacted, compared case-insensitively and ignoring
+	// '-' and '_'. Names such as Authorization, Password, access_token and
+	// SecurityCredential are always redacted.
+	Redact []string
+}
+
+// Log returns Middleware which logs each request to the logger, with its
+// method, URL, status, duration and request and response byte counts, and
+// optionally its headers and bodies. A nil logger uses slog.Default().
+//
+// Secret query parameters, headers, and JSON and form body fields are
+// redacted. Bodies of other media types are logged as sent.
+//
+// Logging never consumes bodies. Request bodies are logged only if they can
+// be replayed with the request's GetBody, as they are for the JSON, form and
+// XML body providers. Responses are logged once their body is read to EOF or
+// closed, as Do does, so that byte counts are known.
+func Log(logger *slog.Logger, opts LogOptions) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = defaultMaxBodyBytes
+	}
+	redact := newRedactor(opts.Redact)
+	return func(next Doer) Doer {
+		return &loggingDoer{next: next, logger: logger, opts: opts, redact: redact}
+	}
+}
+
+// loggingDoer is a Doer which logs requests sent by the next Doer.
+type loggingDoer struct {
+	next   Doer
+	logger *slog.Logger
+	opts   LogOptions
+	redact redactor
+}
+
+// Do sends the request with the next Doer and logs it.
+func (d *loggingDoer) Do(req *http.Request) (*http.Response, error) {
+	attrs := []slog.Attr{
+		slog.String("method", req.Method),
+		slog.String("url", d.redact.url(req.URL)),
+		slog.Int64("request_bytes", req.ContentLength),
+	}
+	if d.opts.Headers {
+		attrs = append(attrs, slog.Any("request_header", d.redact.header(req.Header)))
+	}
+	if d.opts.Bodies {
+		if body, ok := d.requestBody(req); ok {
+			attrs = append(attrs, slog.String("request_body", body))
+		}
+	}
+
+	start := time.Now()
+	resp, err := d.next.Do(req)
+	attrs = append(attrs, slog.Duration("duration", time.Since(start)))
+	if err != nil {
+		// errors such as *url.Error include the unredacted URL
+		message := strings.ReplaceAll(err.Error(), req.URL.String(), d.redact.url(req.URL))
+		attrs = append(attrs, slog.String("error", message))
+		d.logger.LogAttrs(req.Context(), slog.LevelError, "http request failed", attrs...)
+		return resp, err
+	}
+
+	attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	if d.opts.Headers {
+		attrs = append(attrs, slog.Any("response_header", d.redact.header(resp.Header)))
+	}
+	resp.Body = &loggedBody{
+		ReadCloser: resp.Body,
+		doer:       d,
+		ctx:        req.Context(),
+		header:     resp.Header,
+		attrs:      attrs,
+	}
+	return resp, nil
+}
+
+// requestBody returns the request body to log, read from a copy returned by
+// GetBody. ok is false if the request has no body or it can't be replayed.
+func (d *loggingDoer) requestBody(req *http.Request) (body string, ok bool) {
+	if req.Body == nil || req.Body == http.NoBody || req.GetBody == nil {
+		return "", false
+	}
+	rc, err := req.GetBody()
+	if err != nil {
+		return "", false
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(io.LimitReader(rc, maxRedactBodyBytes+1))
+	if err != nil {
+		return "", false
+	}
+	return d.formatBody(req.Header, data), true
+}
+
+// formatBody redacts and truncates the body for logging. Bodies longer than
+// maxRedactBodyBytes are incomplete.
+func (d *loggingDoer) formatBody(header http.Header, body []byte) string {
+	if len(body) > maxRedactBodyBytes {
+		// an incomplete JSON or form body fails to parse and is omitted
+		body = body[:maxRedactBodyBytes]
+	}
+	clean, ok := d.redact.body(header.Get(contentType), body)
+	if !ok {
+		return omittedBody
+	}
+	if len(clean) > d.opts.MaxBodyBytes {
+		return string(clean[:d.opts.MaxBodyBytes]) + "..."
+	}
+	return string(clean)
+}
+
+// loggedBody is a response body which counts and captures the bytes read
+// from it and logs the response on EOF or Close.
+type loggedBody struct {
+	io.ReadCloser
+	doer   *loggingDoer
+	ctx    context.Context
+	header http.Header
+	attrs  []slog.Attr
+
+	mu       sync.Mutex
+	n        int64
+	captured bytes.Buffer
+	logged   bool
+}
+
+// Read reads from the response body, logging the response at EOF.
+func (b *loggedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	b.n += int64(n)
+	if b.doer.opts.Bodies {
+		if room := maxRedactBodyBytes + 1 - b.captured.Len(); room > 0 {
+			if room > n {
+				room = n
+			}
+			b.captured.Write(p[:room])
+		}
+	}
+	b.mu.Unlock()
+	if err == io.EOF {
+		b.log()
+	}
+	return n, err
+}
+
+// Close closes the response body and logs the response, if it wasn't
+// logged at EOF.
+func (b *loggedBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.log()
+	return err
+}
+
+// log logs the response once.
+func (b *loggedBody) log() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.logged {
+		return
+	}
+	b.logged = true
+	attrs := append(b.attrs, slog.Int64("response_bytes", b.n))
+	if b.doer.opts.Bodies && b.captured.Len() > 0 {
+		attrs = append(attrs, slog.String("response_body", b.doer.formatBody(b.header, b.captured.Bytes())))
+	}
+	b.doer.logger.LogAttrs(b.ctx, b.doer.opts.Level, "http request", attrs...)
+}
@@ -0,0 +1,50 @@
+package nougat
+
+import "net/http"
+
+// DoerFunc is an adapter to allow the use of ordinary functions as Doers.
+// If f is a function with the appropriate signature, DoerFunc(f) is a Doer
+// that calls f.
+type DoerFunc func(req *http.Request) (*http.Response, error)
+
+// Do calls f(req).
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps a Doer with client-side behaviour such as retries,
+// logging or authentication, and returns the wrapping Doer.
+type Middleware func(next Doer) Doer
+
+// Use appends middleware to the Nougat's middleware chain. Requests sent by
+// Do pass through the middleware in the order it was added, before reaching
+// the Nougat's Doer.
+//
+// Child Nougats created with New inherit the chain and may extend it without
+// changing the chain of their parent.
+func (r *Nougat) Use(mw ...Middleware) *Nougat {
+	for _, m := range mw {
+		if m != nil {
+			r.middleware = append(r.middleware, m)
+		}
+	}
+	return r
+}
+
+// Retry returns Middleware which retries requests according to the given
+// policy. See Retrier.
+func Retry(policy RetryPolicy) Middleware {
+	return func(next Doer) Doer {
+		return NewRetrier(next, policy)
+	}
+}
+
+// doer returns the Nougat's Doer wrapped in its middleware chain, with the
+// first added middleware outermost.
+func (r *Nougat) doer() Doer {
+	doer := r.httpClient
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		doer = r.middleware[i](doer)
+	}
+	return doer
+}
@@ -0,0 +1,127 @@
+package nougat
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// recordingMiddleware returns Middleware which appends its name to calls
+// before passing the request on.
+func recordingMiddleware(name string, calls *[]string) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			*calls = append(*calls, name)
+			return next.Do(req)
+		})
+	}
+}
+
+func TestUse_order(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/foo", func(w http.ResponseWriter, r *http.Request) {
+		if value := r.Header.Get("X-Middleware"); value != "set" {
+			t.Errorf("expected header set by middleware, got %q", value)
+		}
+		w.WriteHeader(204)
+	})
+
+	var calls []string
+	setHeader := func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			calls = append(calls, "header")
+			req.Header.Set("X-Middleware", "set")
+			return next.Do(req)
+		})
+	}
+
+	_, err := New().Client(client).Use(recordingMiddleware("first", &calls), nil, setHeader).
+		Use(recordingMiddleware("last", &calls)).Get("http://example.com/foo").Receive(nil, nil)
+	if err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	expected := []string{"first", "header", "last"}
+	if !reflect.DeepEqual(expected, calls) {
+		t.Errorf("expected %v, got %v", expected, calls)
+	}
+}
+
+func TestUse_childInheritsChain(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/foo", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	})
+
+	var calls []string
+	parent := New().Client(client).Get("http://example.com/foo").Use(recordingMiddleware("parent", &calls))
+	// extend the parent's chain in two children sharing the same backing array
+	childA := parent.New().Use(recordingMiddleware("a", &calls))
+	childB := parent.New().Use(recordingMiddleware("b", &calls))
+
+	cases := []struct {
+		Nougat   *Nougat
+		expected []string
+	}{
+		{parent, []string{"parent"}},
+		{childA, []string{"parent", "a"}},
+		{childB, []string{"parent", "b"}},
+	}
+	for _, c := range cases {
+		calls = nil
+		if _, err := c.Nougat.Receive(nil, nil); err != nil {
+			t.Errorf("expected nil, got %v", err)
+		}
+		if !reflect.DeepEqual(c.expected, calls) {
+			t.Errorf("expected %v, got %v", c.expected, calls)
+		}
+	}
+}
+
+func TestUse_doerWrappedByChain(t *testing.T) {
+	var calls []string
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		calls = append(calls, "doer")
+		return &http.Response{StatusCode: 204, Header: http.Header{}, Body: http.NoBody}, nil
+	})
+
+	// setting the Doer after Use keeps the chain in front of the new Doer
+	Nougat := New().Use(recordingMiddleware("mw", &calls)).Doer(doer)
+	if _, err := Nougat.Get("http://example.com/").Receive(nil, nil); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	expected := []string{"mw", "doer"}
+	if !reflect.DeepEqual(expected, calls) {
+		t.Errorf("expected %v, got %v", expected, calls)
+	}
+}
+
+func TestRetry_middleware(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	var calls int
+	mux.HandleFunc("/foo", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprintf(w, `{"text": "Some text"}`)
+	})
+
+	model := new(FakeModel)
+	resp, err := New().Client(client).Use(Retry(RetryPolicy{MinBackoff: time.Millisecond})).
+		Get("http://example.com/foo").Receive(model, nil)
+	if err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if resp.StatusCode != 200 || model.Text != "Some text" {
+		t.Errorf("expected decoded 200 response, got %d %v", resp.StatusCode, model)
+	}
+	if calls != 2 {
+		t.Errorf("expected %d calls, got %d", 2, calls)
+	}
+}
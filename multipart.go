@@ -0,0 +1,213 @@
+package nougat
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	multipartContentType = "multipart/form-data"
+	defaultFileType      = "application/octet-stream"
+)
+
+type (
+	// Multipart builds a multipart/form-data body of text fields and file
+	// parts. File contents are streamed when the body is read, so large files
+	// never sit fully in memory.
+	Multipart struct {
+		boundary string
+		parts    []multipartPart
+	}
+
+	// multipartPart is a text field, or a file part if open is set.
+	multipartPart struct {
+		field       string
+		value       string
+		filename    string
+		contentType string
+		open        func() (io.ReadCloser, error)
+		// once is set for parts which can only be read once
+		once bool
+	}
+
+	// multipartBodyProvider streams a Multipart as a Body for requests.
+	multipartBodyProvider struct {
+		multipart *Multipart
+	}
+)
+
+// NewMultipart returns an empty Multipart with a random boundary.
+func NewMultipart() *Multipart {
+	return &Multipart{boundary: multipart.NewWriter(ioutil.Discard).Boundary()}
+}
+
+// Boundary returns the boundary separating the parts.
+func (m *Multipart) Boundary() string {
+	return m.boundary
+}
+
+// ContentType returns the multipart/form-data Content-Type with the
+// Multipart's boundary.
+func (m *Multipart) ContentType() string {
+	return multipartContentType + "; boundary=" + m.boundary
+}
+
+// Field adds a text field with the given name and value.
+func (m *Multipart) Field(name, value string) *Multipart {
+	m.parts = append(m.parts, multipartPart{field: name, value: value})
+	return m
+}
+
+// File adds a file part with the given field name, filename and content
+// type, read from r. The reader is consumed the first time the body is read,
+// so a Nougat using the Multipart can only send one request.
+// If contentType is empty, "application/octet-stream" is used.
+// If r is also an io.Closer, it is closed after it has been read.
+func (m *Multipart) File(field, filename, contentType string, r io.Reader) *Multipart {
+	// used is shared by copies of the Multipart in child Nougats, which may
+	// send their requests concurrently
+	var used int32
+	m.FileFunc(field, filename, contentType, func() (io.ReadCloser, error) {
+		if !atomic.CompareAndSwapInt32(&used, 0, 1) {
+			return nil, fmt.Errorf("nougat: multipart file %q was already read", filename)
+		}
+		if rc, ok := r.(io.ReadCloser); ok {
+			return rc, nil
+		}
+		return ioutil.NopCloser(r), nil
+	})
+	m.parts[len(m.parts)-1].once = true
+	return m
+}
+
+// FileFunc adds a file part with the given field name, filename and content
+// type, whose content is read from the io.ReadCloser returned by open each
+// time the body is read.
+// If contentType is empty, "application/octet-stream" is used.
+func (m *Multipart) FileFunc(field, filename, contentType string, open func() (io.ReadCloser, error)) *Multipart {
+	if contentType == "" {
+		contentType = defaultFileType
+	}
+	m.parts = append(m.parts, multipartPart{field: field, filename: filename, contentType: contentType, open: open})
+	return m
+}
+
+// FilePath adds a file part with the given field name and content type,
+// streamed from the file at path. The filename is the last element of path.
+// If contentType is empty, "application/octet-stream" is used.
+func (m *Multipart) FilePath(field, path, contentType string) *Multipart {
+	return m.FileFunc(field, filepath.Base(path), contentType, func() (io.ReadCloser, error) {
+		return os.Open(path)
+	})
+}
+
+// WriteTo writes the encoded multipart body to w.
+func (m *Multipart) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	mw := multipart.NewWriter(cw)
+	if err := mw.SetBoundary(m.boundary); err != nil {
+		return cw.n, err
+	}
+	for _, part := range m.parts {
+		if err := writePart(mw, part); err != nil {
+			return cw.n, err
+		}
+	}
+	err := mw.Close()
+	return cw.n, err
+}
+
+// writePart writes a single field or file part.
+func writePart(mw *multipart.Writer, part multipartPart) error {
+	if part.open == nil {
+		return mw.WriteField(part.field, part.value)
+	}
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+		escapeQuotes(part.field), escapeQuotes(part.filename)))
+	header.Set(contentType, part.contentType)
+	w, err := mw.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	file, err := part.open()
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// escapeQuotes escapes a Content-Disposition parameter value, as done by
+// mime/multipart.
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+// countingWriter counts the bytes written to w.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+/********************************** MULTIPART BODY *********************************************/
+
+func (p multipartBodyProvider) ContentType() string {
+	return p.multipart.ContentType()
+}
+
+// Replayable reports whether the Multipart has no File parts, which can only
+// be read once.
+func (p multipartBodyProvider) Replayable() bool {
+	for _, part := range p.multipart.parts {
+		if part.once {
+			return false
+		}
+	}
+	return true
+}
+
+// Body returns a reader streaming the multipart body as it is encoded.
+// Closing the reader stops the encoding.
+func (p multipartBodyProvider) Body() (io.Reader, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := p.multipart.WriteTo(pw)
+		pw.CloseWithError(err)
+	}()
+	return pr, nil
+}
+
+// BodyMultipart sets the Nougat's body to the multipart/form-data encoded
+// text fields and files of the given Multipart. For example,
+//
+//	form := nougat.NewMultipart().
+//		Field("description", "March statement").
+//		FilePath("statement", "/tmp/statement.pdf", "application/pdf")
+//	req, err := nougat.New().Post("https://api.io/uploads").BodyMultipart(form).Request()
+//
+// The body is streamed as it is sent (see Request()).
+// A nil Multipart leaves the body unchanged and records an error (see Err()).
+func (r *Nougat) BodyMultipart(m *Multipart) *Nougat {
+	if m == nil {
+		r.setErr("BodyMultipart", errNilBody)
+		return r
+	}
+	return r.BodyProvider(multipartBodyProvider{multipart: m})
+}
@@ -0,0 +1,141 @@
+package nougat
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMultipart_contentType(t *testing.T) {
+	m := NewMultipart()
+	mediaType, params, err := mime.ParseMediaType(m.ContentType())
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if mediaType != multipartContentType || params["boundary"] != m.Boundary() || m.Boundary() == "" {
+		t.Errorf("unexpected Content-Type %s", m.ContentType())
+	}
+	if other := NewMultipart(); other.Boundary() == m.Boundary() {
+		t.Errorf("expected random boundaries, got %s twice", m.Boundary())
+	}
+}
+
+func TestBodyMultipartSetter(t *testing.T) {
+	m := NewMultipart().Field("a", "b")
+	Nougat := New().BodyMultipart(m)
+	if Nougat.bodyProvider != (multipartBodyProvider{multipart: m}) {
+		t.Errorf("expected multipart body provider, got %v", Nougat.bodyProvider)
+	}
+	if value := Nougat.header.Get(contentType); value != m.ContentType() {
+		t.Errorf("expected %s, got %s", m.ContentType(), value)
+	}
+	// nil Multipart does not replace the body
+	if Nougat.BodyMultipart(nil).bodyProvider != (multipartBodyProvider{multipart: m}) {
+		t.Errorf("nil Multipart should not replace the existing body")
+	}
+}
+
+func TestReceive_multipart(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "statement.csv")
+	if err := ioutil.WriteFile(path, []byte("date,amount\n2020-01-01,100\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("expected nil, got %v", err)
+			return
+		}
+		if value := r.FormValue("description"); value != "March statement" {
+			t.Errorf("expected %s, got %s", "March statement", value)
+		}
+		cases := []struct {
+			field, filename, contentType, content string
+		}{
+			{"statement", "statement.csv", "text/csv", "date,amount\n2020-01-01,100\n"},
+			{"note", `the "note".txt`, defaultFileType, "hello"},
+		}
+		for _, c := range cases {
+			file, header, err := r.FormFile(c.field)
+			if err != nil {
+				t.Errorf("expected nil, got %v", err)
+				continue
+			}
+			content, _ := ioutil.ReadAll(file)
+			file.Close()
+			if header.Filename != c.filename || header.Header.Get("Content-Type") != c.contentType || string(content) != c.content {
+				t.Errorf("expected %s %s %q, got %s %s %q", c.filename, c.contentType, c.content,
+					header.Filename, header.Header.Get("Content-Type"), content)
+			}
+		}
+		fmt.Fprintf(w, `{"text": "uploaded"}`)
+	})
+
+	form := NewMultipart().
+		Field("description", "March statement").
+		FilePath("statement", path, "text/csv").
+		File("note", `the "note".txt`, "", strings.NewReader("hello"))
+
+	model := new(FakeModel)
+	_, err := New().Client(client).Post("http://example.com/upload").BodyMultipart(form).Receive(model, nil)
+	if err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if model.Text != "uploaded" {
+		t.Errorf("expected %s, got %s", "uploaded", model.Text)
+	}
+}
+
+func TestMultipart_fileError(t *testing.T) {
+	form := NewMultipart().FilePath("statement", filepath.Join(t.TempDir(), "missing.pdf"), "")
+	req, err := New().Post("http://a.io/upload").BodyMultipart(form).Request()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	// errors opening files surface when the streamed body is read
+	_, err = ioutil.ReadAll(req.Body)
+	if !os.IsNotExist(err) {
+		t.Errorf("expected a not exist error, got %v", err)
+	}
+}
+
+func TestMultipart_closingBodyStopsEncoding(t *testing.T) {
+	done := make(chan struct{})
+	form := NewMultipart().FileFunc("big", "big.bin", "", func() (io.ReadCloser, error) {
+		return closeNotifier{Reader: endlessReader{}, done: done}, nil
+	})
+	body, _ := multipartBodyProvider{multipart: form}.Body()
+	io.CopyN(ioutil.Discard, body, 1<<16)
+	body.(io.Closer).Close()
+	<-done
+}
+
+// endlessReader returns an infinite stream of zero bytes.
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+// closeNotifier closes done when it is closed.
+type closeNotifier struct {
+	io.Reader
+	done chan struct{}
+}
+
+func (c closeNotifier) Close() error {
+	close(c.done)
+	return nil
+}
@@ -0,0 +1,114 @@
+package nougat
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const accept = "Accept"
+
+// ErrUnsupportedMediaType matches, with errors.Is, the
+// *UnsupportedMediaTypeError returned for responses without a registered
+// decoder.
+var ErrUnsupportedMediaType = errors.New("nougat: unsupported media type")
+
+// UnsupportedMediaTypeError is returned when decoders are registered with
+// Decoder and a response has a Content-Type none of them handles.
+type UnsupportedMediaTypeError struct {
+	// MediaType is the media type of the response, without parameters.
+	MediaType string
+	// StatusCode is the response status code.
+	StatusCode int
+}
+
+func (e *UnsupportedMediaTypeError) Error() string {
+	return fmt.Sprintf("nougat: unsupported media type %q in %d %s response",
+		e.MediaType, e.StatusCode, http.StatusText(e.StatusCode))
+}
+
+// Is reports whether target is ErrUnsupportedMediaType.
+func (e *UnsupportedMediaTypeError) Is(target error) bool {
+	return target == ErrUnsupportedMediaType
+}
+
+// mediaDecoder is a ResponseDecoder registered for a media type.
+type mediaDecoder struct {
+	mediaType string
+	decoder   ResponseDecoder
+}
+
+// Decoder registers the decoder for responses with the given media type,
+// such as "application/xml". Once decoders are registered, responses are
+// decoded with the decoder matching their Content-Type, and new requests
+// (see Request()) accept the registered media types unless an Accept header
+// was set.
+// Media types with a structured syntax suffix, such as
+// "application/problem+json", fall back to the decoder for
+// "application/json" or "application/xml". Responses without a
+// Content-Type are decoded with the default ResponseDecoder, and responses
+// with any other media type return an *UnsupportedMediaTypeError.
+// Registering a nil decoder removes the media type.
+func (r *Nougat) Decoder(mediaType string, decoder ResponseDecoder) *Nougat {
+	mediaType = normalizeMediaType(mediaType)
+	decoders := make([]mediaDecoder, 0, len(r.decoders)+1)
+	for _, d := range r.decoders {
+		if d.mediaType != mediaType {
+			decoders = append(decoders, d)
+		}
+	}
+	if decoder != nil {
+		decoders = append(decoders, mediaDecoder{mediaType: mediaType, decoder: decoder})
+	}
+	r.decoders = decoders
+	return r
+}
+
+// decoderFor returns the ResponseDecoder for the response's Content-Type.
+func (r *Nougat) decoderFor(resp *http.Response) (ResponseDecoder, error) {
+	value := resp.Header.Get(contentType)
+	if len(r.decoders) == 0 || value == "" {
+		return r.responseDecoder, nil
+	}
+	mediaType := normalizeMediaType(value)
+	candidates := []string{mediaType}
+	if i := strings.LastIndex(mediaType, "+"); i >= 0 {
+		switch mediaType[i+1:] {
+		case "json":
+			candidates = append(candidates, jsonContentType)
+		case "xml":
+			candidates = append(candidates, xmlContentType)
+		}
+	}
+	for _, candidate := range candidates {
+		for _, d := range r.decoders {
+			if d.mediaType == candidate {
+				return d.decoder, nil
+			}
+		}
+	}
+	return nil, &UnsupportedMediaTypeError{MediaType: mediaType, StatusCode: resp.StatusCode}
+}
+
+// acceptHeader returns the Accept header value listing the registered
+// media types.
+func (r *Nougat) acceptHeader() string {
+	mediaTypes := make([]string, len(r.decoders))
+	for i, d := range r.decoders {
+		mediaTypes[i] = d.mediaType
+	}
+	return strings.Join(mediaTypes, ", ")
+}
+
+// normalizeMediaType returns the lower-cased media type without parameters.
+func normalizeMediaType(value string) string {
+	if mediaType, _, err := mime.ParseMediaType(value); err == nil {
+		return mediaType
+	}
+	if i := strings.Index(value, ";"); i >= 0 {
+		value = value[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(value))
+}
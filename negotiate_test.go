@@ -0,0 +1,129 @@
+package nougat
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestDecoderSetter(t *testing.T) {
+	Nougat := New().Decoder("application/json", JSONDecoder()).Decoder("Application/XML; charset=utf-8", XMLDecoder())
+	expected := []mediaDecoder{{jsonContentType, jsonDecoder{}}, {xmlContentType, xmlDecoder{}}}
+	if !reflect.DeepEqual(expected, Nougat.decoders) {
+		t.Errorf("expected %v, got %v", expected, Nougat.decoders)
+	}
+	// re-registering a media type replaces its decoder, nil removes it
+	child := Nougat.New().Decoder("application/json", SOAPDecoder()).Decoder("application/xml", nil)
+	if expected := []mediaDecoder{{jsonContentType, soapDecoder{}}}; !reflect.DeepEqual(expected, child.decoders) {
+		t.Errorf("expected %v, got %v", expected, child.decoders)
+	}
+	// the parent registry is unchanged
+	if !reflect.DeepEqual(expected, Nougat.decoders) {
+		t.Errorf("expected %v, got %v", expected, Nougat.decoders)
+	}
+}
+
+func TestRequest_acceptHeader(t *testing.T) {
+	cases := []struct {
+		Nougat   *Nougat
+		expected string
+	}{
+		{New(), ""},
+		{New().Decoder("application/json", JSONDecoder()).Decoder("text/xml", XMLDecoder()), "application/json, text/xml"},
+		// an explicit Accept header is kept
+		{New().Set("Accept", "application/vnd.api+json").Decoder("application/json", JSONDecoder()), "application/vnd.api+json"},
+	}
+	for _, c := range cases {
+		req, _ := c.Nougat.Request()
+		if value := req.Header.Get("Accept"); value != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, value)
+		}
+	}
+}
+
+func TestDecoderFor(t *testing.T) {
+	Nougat := New().ResponseDecoder(SOAPDecoder()).
+		Decoder("application/json", JSONDecoder()).
+		Decoder("application/xml", XMLDecoder())
+	cases := []struct {
+		contentType string
+		expected    ResponseDecoder
+		err         error
+	}{
+		{"application/json", jsonDecoder{}, nil},
+		{"application/json; charset=utf-8", jsonDecoder{}, nil},
+		{"APPLICATION/XML", xmlDecoder{}, nil},
+		{"application/problem+json", jsonDecoder{}, nil},
+		{"application/atom+xml", xmlDecoder{}, nil},
+		// no Content-Type falls back to the default decoder
+		{"", soapDecoder{}, nil},
+		{"text/html; charset=utf-8", nil, &UnsupportedMediaTypeError{MediaType: "text/html", StatusCode: 502}},
+	}
+	for _, c := range cases {
+		resp := &http.Response{StatusCode: 502, Header: http.Header{}}
+		if c.contentType != "" {
+			resp.Header.Set("Content-Type", c.contentType)
+		}
+		decoder, err := Nougat.decoderFor(resp)
+		if decoder != c.expected || !reflect.DeepEqual(c.err, err) {
+			t.Errorf("%s: expected (%v, %v), got (%v, %v)", c.contentType, c.expected, c.err, decoder, err)
+		}
+	}
+	// without registered decoders, the default decoder is always used
+	resp := &http.Response{Header: http.Header{"Content-Type": []string{"text/html"}}}
+	if decoder, err := New().decoderFor(resp); decoder != (jsonDecoder{}) || err != nil {
+		t.Errorf("expected the default decoder, got (%v, %v)", decoder, err)
+	}
+}
+
+func TestReceive_negotiatedDecoder(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"text": "json text"}`)
+	})
+	mux.HandleFunc("/xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, `<response><text>xml text</text></response>`)
+	})
+	mux.HandleFunc("/gateway", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.WriteHeader(502)
+		fmt.Fprintf(w, `<html><body>Bad Gateway</body></html>`)
+	})
+
+	api := New().Client(client).Base("http://example.com/").
+		Decoder("application/json", JSONDecoder()).
+		Decoder("application/xml", XMLDecoder())
+
+	for _, path := range []string{"json", "xml"} {
+		model := new(FakeModel)
+		if _, err := api.New().Get(path).Receive(model, new(APIError)); err != nil {
+			t.Errorf("expected nil, got %v", err)
+		}
+		if expected := path + " text"; model.Text != expected {
+			t.Errorf("expected %s, got %s", expected, model.Text)
+		}
+	}
+
+	resp, err := api.New().Get("gateway").Receive(new(FakeModel), new(APIError))
+	if !errors.Is(err, ErrUnsupportedMediaType) {
+		t.Errorf("expected %v, got %v", ErrUnsupportedMediaType, err)
+	}
+	if expected := `nougat: unsupported media type "text/html" in 502 Bad Gateway response`; err == nil || err.Error() != expected {
+		t.Errorf("expected %s, got %v", expected, err)
+	}
+	if resp.StatusCode != 502 {
+		t.Errorf("expected %d, got %d", 502, resp.StatusCode)
+	}
+
+	// with ErrorOnFailure, the undecodable body is kept in the HTTPError
+	_, err = api.New().Get("gateway").ErrorOnFailure(true).Receive(new(FakeModel), new(APIError))
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Failure != nil || string(httpErr.Body) != "<html><body>Bad Gateway</body></html>" {
+		t.Errorf("expected an *HTTPError with the body snippet, got %v", err)
+	}
+}
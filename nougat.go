@@ -1,24 +1,26 @@
 package nougat
 
 import (
+	"context"
 	"net/http"
 )
 
 // Doer executes http requests.  It is implemented by *http.Client.  You can
 // wrap *http.Client with layers of Doers to form a stack of client-side
-// middleware.
+// middleware (see Middleware and Nougat.Use).
 type Doer interface {
 	Do(req *http.Request) (*http.Response, error)
 }
 
-// Sending
-
-type APIError struct {
-	Message string `json:"message"`
-	Code    int    `json:"code"`
-}
-
 // Nougat is an HTTP Request builder and sender.
+//
+// Setters modify the Nougat, so a Nougat must not be configured from
+// multiple goroutines. Once configured, a parent Nougat which is no longer
+// modified may be used concurrently from many goroutines to create child
+// Nougats with New and to build and send requests with Request, Receive and
+// Do, provided its Doer, middleware and BodyProvider are safe for concurrent
+// use. The built-in ones are, except for a body set with Body or a
+// Multipart with File parts, whose readers can only be read once.
 type Nougat struct {
 	// http Client for doing requests
 	httpClient Doer
@@ -30,10 +32,30 @@ type Nougat struct {
 	header http.Header
 	// url tagged query structs
 	queryStructs []interface{}
+	// values of path template placeholders
+	pathParams map[string]string
+	// path tagged structs with values of path template placeholders
+	pathStructs []interface{}
+	// names of the placeholders written in Base and Path templates
+	placeholders []string
 	// body provider
 	bodyProvider BodyProvider
+	// encoding request bodies are compressed with
+	compression Encoding
 	// response decoder
 	responseDecoder ResponseDecoder
+	// response decoders by media type
+	decoders []mediaDecoder
+	// context for building and sending requests
+	ctx context.Context
+	// middleware wrapping httpClient, outermost first
+	middleware []Middleware
+	// token source authorizing requests
+	tokenSource TokenSource
+	// return an HTTPError for non-2XX responses
+	errorOnFailure bool
+	// first error recorded by a setter
+	err error
 }
 
 // New returns a new Nougat with an http DefaultClient.
@@ -57,25 +79,38 @@ func New() *Nougat {
 // fooNougat and barNougat will both use the same client, but send requests to
 // https://api.io/foo/ and https://api.io/bar/ respectively.
 //
-// Note that query and body values are copied so if pointer values are used,
-// mutating the original value will mutate the value within the child Nougat.
+// Headers, query structs, path parameters and the payloads of the built-in
+// body providers are deep copied, so mutating a value after passing it to
+// the parent, or configuring the child, doesn't affect the other Nougat.
+// The Doer, middleware, TokenSource, context and custom BodyProviders
+// (including readers passed to Body) are shared.
 func (r *Nougat) New() *Nougat {
-	// copy Headers pairs into new Header map
-	headerCopy := make(http.Header)
-	for k, v := range r.header {
-		headerCopy[k] = v
-	}
 	return &Nougat{
 		httpClient:      r.httpClient,
 		method:          r.method,
 		rawURL:          r.rawURL,
-		header:          headerCopy,
-		queryStructs:    append([]interface{}{}, r.queryStructs...),
-		bodyProvider:    r.bodyProvider,
+		header:          cloneHeader(r.header),
+		queryStructs:    cloneValues(r.queryStructs),
+		pathParams:      clonePathParams(r.pathParams),
+		pathStructs:     cloneValues(r.pathStructs),
+		placeholders:    append([]string(nil), r.placeholders...),
+		bodyProvider:    cloneBodyProvider(r.bodyProvider),
+		compression:     r.compression,
 		responseDecoder: r.responseDecoder,
+		decoders:        append([]mediaDecoder(nil), r.decoders...),
+		ctx:             r.ctx,
+		middleware:      append([]Middleware(nil), r.middleware...),
+		tokenSource:     r.tokenSource,
+		errorOnFailure:  r.errorOnFailure,
+		err:             r.err,
 	}
 }
 
+// Clone is an alias for New.
+func (r *Nougat) Clone() *Nougat {
+	return r.New()
+}
+
 // Http Client
 
 // Client sets the http Client used to do requests.
@@ -88,6 +123,7 @@ func (r *Nougat) Client(httpClient *http.Client) *Nougat {
 }
 
 // Doer sets the custom Doer implementation used to do requests.
+// Middleware added with Use wraps the Doer.
 // If a nil client is given, the http.DefaultClient will be used.
 func (r *Nougat) Doer(doer Doer) *Nougat {
 	if doer == nil {
@@ -0,0 +1,353 @@
+// Package nougattest provides a programmable fake HTTP server for testing
+// code which uses nougat.
+//
+//	srv := nougattest.NewServer(t)
+//	srv.Expect("GET", "/users/{id}").
+//		WithQuery("fields", "name").
+//		WithHeader("Authorization", "Bearer token").
+//		Respond(200, User{Name: "Ann"})
+//
+//	user := new(User)
+//	_, err := srv.Nougat().Auth(tokens).Get("users/42").QueryStruct(params).ReceiveSuccess(user)
+//
+// Unmet expectations are reported when the test finishes.
+package nougattest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wondenge/nougat"
+)
+
+// Server is a fake HTTP server which routes requests to Expectations by
+// method and path, checks them against the Expectation and responds with
+// the Expectation's queued responses. Failures are reported to the
+// testing.TB the Server was created with.
+type Server struct {
+	t      testing.TB
+	server *httptest.Server
+
+	mu           sync.Mutex
+	expectations []*Expectation
+}
+
+// NewServer starts a Server which is closed, and whose unmet expectations
+// are reported, when the test finishes.
+func NewServer(t testing.TB) *Server {
+	s := &Server{t: t}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(func() {
+		s.Close()
+		s.AssertExpectations()
+	})
+	return s
+}
+
+// URL returns the Server's base URL, e.g. "http://127.0.0.1:8080".
+func (s *Server) URL() string {
+	return s.server.URL
+}
+
+// Client returns an *http.Client which sends requests to the Server.
+func (s *Server) Client() *http.Client {
+	return s.server.Client()
+}
+
+// Nougat returns a new Nougat which sends requests to the Server, with the
+// Server's URL as its Base, so paths may be relative.
+func (s *Server) Nougat() *nougat.Nougat {
+	return nougat.New().Client(s.Client()).Base(s.URL() + "/")
+}
+
+// Close shuts down the Server. It is called when the test finishes.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Expect adds an Expectation of requests with the method and path. Path
+// segments in braces, such as "/users/{id}", match any value.
+func (s *Server) Expect(method, path string) *Expectation {
+	e := &Expectation{
+		mu:     &s.mu,
+		method: strings.ToUpper(method),
+		path:   path,
+		query:  make(map[string][]string),
+		header: make(http.Header),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expectations = append(s.expectations, e)
+	return e
+}
+
+// AssertExpectations reports Expectations which were called fewer times
+// than expected. Calls beyond those set with Times are reported as they
+// are received. It is called when the test finishes.
+func (s *Server) AssertExpectations() {
+	s.t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, e := range s.expectations {
+		if calls, times := e.calls, e.expectedCalls(); calls < times {
+			s.t.Errorf("nougattest: expected %d calls to %s, got %d", times, e, calls)
+		}
+	}
+}
+
+// serveHTTP responds to the request with the first Expectation whose route
+// and conditions match, and reports requests which match none.
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s.t.Errorf("nougattest: reading %s %s body: %v", r.Method, r.URL.Path, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	var match, exhausted *Expectation
+	var mismatches []string
+	for _, e := range s.expectations {
+		if !e.routes(r) {
+			continue
+		}
+		if e.times > 0 && e.calls >= e.times {
+			exhausted = e
+			continue
+		}
+		if problems := e.check(r, body); len(problems) > 0 {
+			mismatches = append(mismatches, problems...)
+			continue
+		}
+		match = e
+		break
+	}
+	var resp response
+	if match != nil {
+		resp = match.next()
+	}
+	s.mu.Unlock()
+
+	switch {
+	case match != nil:
+		resp.write(w)
+	case len(mismatches) > 0:
+		s.t.Errorf("nougattest: unexpected %s %s:\n\t%s", r.Method, r.URL, strings.Join(mismatches, "\n\t"))
+		http.Error(w, "nougattest: request doesn't match expectations", http.StatusNotImplemented)
+	case exhausted != nil:
+		s.t.Errorf("nougattest: too many calls to %s, expected %d", exhausted, exhausted.times)
+		http.Error(w, "nougattest: too many calls", http.StatusNotImplemented)
+	default:
+		s.t.Errorf("nougattest: unexpected %s %s, no expectation for the route", r.Method, r.URL)
+		http.Error(w, "nougattest: no expectation for the route", http.StatusNotImplemented)
+	}
+}
+
+// Expectation is an expected request and its queued responses. Its
+// methods may be chained and must be called before requests are sent.
+type Expectation struct {
+	mu     *sync.Mutex
+	method string
+	path   string
+	query  map[string][]string
+	header http.Header
+	body   interface{}
+	json   bool
+
+	times     int
+	responses []response
+	calls     int
+}
+
+// WithQuery expects the request query parameter key to have the value.
+// Repeated calls for the same key expect each value in order.
+func (e *Expectation) WithQuery(key, value string) *Expectation {
+	e.query[key] = append(e.query[key], value)
+	return e
+}
+
+// WithHeader expects the request header key to contain the value.
+func (e *Expectation) WithHeader(key, value string) *Expectation {
+	e.header.Add(key, value)
+	return e
+}
+
+// WithJSON expects the request body to be JSON equal to the JSON encoding
+// of v, ignoring formatting and object key order.
+func (e *Expectation) WithJSON(v interface{}) *Expectation {
+	data, err := json.Marshal(v)
+	if err == nil {
+		err = json.Unmarshal(data, &e.body)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("nougattest: WithJSON: %v", err))
+	}
+	e.json = true
+	return e
+}
+
+// Times expects exactly n calls. Without Times, at least one call is
+// expected for each queued response, or at least one call if none are
+// queued.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// Respond queues a response with the status code and body. A string or
+// []byte body is written as is and other non-nil bodies are JSON encoded.
+// Responses are sent in the order they were queued and the last is
+// repeated. Without a queued response, 200 OK is sent with no body.
+func (e *Expectation) Respond(statusCode int, body interface{}) *Expectation {
+	return e.RespondWithHeader(statusCode, nil, body)
+}
+
+// RespondWithHeader queues a response like Respond with the given headers.
+func (e *Expectation) RespondWithHeader(statusCode int, header http.Header, body interface{}) *Expectation {
+	resp := response{statusCode: statusCode, header: header}
+	switch b := body.(type) {
+	case nil:
+	case string:
+		resp.body = []byte(b)
+	case []byte:
+		resp.body = b
+	default:
+		data, err := json.Marshal(body)
+		if err != nil {
+			panic(fmt.Sprintf("nougattest: Respond: %v", err))
+		}
+		resp.body = data
+		resp.json = true
+	}
+	e.responses = append(e.responses, resp)
+	return e
+}
+
+// Calls returns the number of requests matched by the Expectation.
+func (e *Expectation) Calls() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calls
+}
+
+// String returns the Expectation's method and path.
+func (e *Expectation) String() string {
+	return e.method + " " + e.path
+}
+
+// expectedCalls returns the number of expected calls.
+func (e *Expectation) expectedCalls() int {
+	if e.times > 0 {
+		return e.times
+	}
+	if len(e.responses) > 1 {
+		return len(e.responses)
+	}
+	return 1
+}
+
+// routes reports whether the request method and path match.
+func (e *Expectation) routes(r *http.Request) bool {
+	if e.method != r.Method {
+		return false
+	}
+	expected := strings.Split(strings.Trim(e.path, "/"), "/")
+	// split the escaped path, so that escaped '/' stay within a segment
+	actual := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	if len(expected) != len(actual) {
+		return false
+	}
+	for i, segment := range expected {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			continue
+		}
+		value, err := url.PathUnescape(actual[i])
+		if err != nil || segment != value {
+			return false
+		}
+	}
+	return true
+}
+
+// check returns descriptions of the ways the request doesn't meet the
+// Expectation's conditions.
+func (e *Expectation) check(r *http.Request, body []byte) []string {
+	var problems []string
+	query := r.URL.Query()
+	for key, values := range e.query {
+		if !reflect.DeepEqual(values, query[key]) {
+			problems = append(problems, fmt.Sprintf("%s: query %s: expected %q, got %q", e, key, values, query[key]))
+		}
+	}
+	for key, values := range e.header {
+		for _, value := range values {
+			if !contains(r.Header.Values(key), value) {
+				problems = append(problems, fmt.Sprintf("%s: header %s: expected %q, got %q", e, key, value, r.Header.Values(key)))
+			}
+		}
+	}
+	if e.json {
+		var actual interface{}
+		if err := json.Unmarshal(body, &actual); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: body: expected JSON, got %q: %v", e, body, err))
+		} else if !reflect.DeepEqual(e.body, actual) {
+			expected, _ := json.Marshal(e.body)
+			problems = append(problems, fmt.Sprintf("%s: body: expected %s, got %s", e, expected, bytes.TrimSpace(body)))
+		}
+	}
+	return problems
+}
+
+// next counts a call and returns its response.
+func (e *Expectation) next() response {
+	e.calls++
+	switch {
+	case len(e.responses) == 0:
+		return response{statusCode: http.StatusOK}
+	case e.calls <= len(e.responses):
+		return e.responses[e.calls-1]
+	}
+	return e.responses[len(e.responses)-1]
+}
+
+// response is a queued response.
+type response struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+	json       bool
+}
+
+// write writes the response.
+func (resp response) write(w http.ResponseWriter) {
+	for key, values := range resp.header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	if resp.json && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(resp.statusCode)
+	w.Write(resp.body)
+}
+
+// contains reports whether values contains value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+package nougattest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingT records the failures reported to it and runs its cleanups
+// when finished.
+type recordingT struct {
+	testing.TB
+	mu       sync.Mutex
+	errors   []string
+	cleanups []func()
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func (t *recordingT) Cleanup(f func()) {
+	t.cleanups = append(t.cleanups, f)
+}
+
+// finish runs the cleanups and returns the reported failures.
+func (t *recordingT) finish() []string {
+	for i := len(t.cleanups) - 1; i >= 0; i-- {
+		t.cleanups[i]()
+	}
+	return t.errors
+}
+
+type fakeUser struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type fakeParams struct {
+	Fields string `url:"fields"`
+}
+
+func TestServer(t *testing.T) {
+	srv := NewServer(t)
+	srv.Expect("GET", "/users/{id}").
+		WithQuery("fields", "name").
+		WithHeader("X-Tenant", "a").
+		Respond(200, fakeUser{ID: 42, Name: "Ann"})
+	create := srv.Expect("POST", "/users").
+		WithJSON(map[string]interface{}{"name": "Bob"}).
+		RespondWithHeader(201, http.Header{"Location": {"/users/43"}}, fakeUser{ID: 43, Name: "Bob"})
+
+	user := new(fakeUser)
+	resp, err := srv.Nougat().Set("X-Tenant", "a").Get("users/42").QueryStruct(fakeParams{Fields: "name"}).ReceiveSuccess(user)
+	if err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if resp.StatusCode != 200 || *user != (fakeUser{ID: 42, Name: "Ann"}) {
+		t.Errorf("expected Ann, got %d %v", resp.StatusCode, user)
+	}
+	if value := resp.Header.Get("Content-Type"); value != "application/json" {
+		t.Errorf("expected application/json, got %s", value)
+	}
+
+	created := new(fakeUser)
+	resp, err = srv.Nougat().Post("users").BodyJSON(map[string]string{"name": "Bob"}).ReceiveSuccess(created)
+	if err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if resp.StatusCode != 201 || resp.Header.Get("Location") != "/users/43" || created.ID != 43 {
+		t.Errorf("expected created Bob, got %d %v %v", resp.StatusCode, resp.Header, created)
+	}
+	if calls := create.Calls(); calls != 1 {
+		t.Errorf("expected %d calls, got %d", 1, calls)
+	}
+
+	// parameters may contain escaped '/'
+	srv.Expect("GET", "/files/{name}/meta data").Respond(204, nil)
+	resp, err = srv.Nougat().Get("files/{name}/meta%20data").PathParam("name", "a/b").ReceiveSuccess(nil)
+	if err != nil || resp.StatusCode != 204 {
+		t.Errorf("expected 204, got %v %v", resp, err)
+	}
+}
+
+func TestServer_failures(t *testing.T) {
+	cases := []struct {
+		setup          func(srv *Server)
+		send           func(srv *Server)
+		expectedErrors []string
+	}{
+		{
+			func(srv *Server) { srv.Expect("GET", "/foo") },
+			func(srv *Server) {},
+			[]string{"nougattest: expected 1 calls to GET /foo, got 0"},
+		},
+		{
+			func(srv *Server) { srv.Expect("GET", "/foo").Respond(200, "a").Respond(200, "b") },
+			func(srv *Server) { srv.Nougat().Get("foo").Receive(nil, nil) },
+			[]string{"nougattest: expected 2 calls to GET /foo, got 1"},
+		},
+		{
+			func(srv *Server) {},
+			func(srv *Server) { srv.Nougat().Get("foo").Receive(nil, nil) },
+			[]string{"nougattest: unexpected GET /foo, no expectation for the route"},
+		},
+		{
+			func(srv *Server) { srv.Expect("GET", "/foo").Times(1) },
+			func(srv *Server) {
+				srv.Nougat().Get("foo").Receive(nil, nil)
+				srv.Nougat().Get("foo").Receive(nil, nil)
+			},
+			[]string{"nougattest: too many calls to GET /foo, expected 1"},
+		},
+		{
+			func(srv *Server) { srv.Expect("GET", "/foo").WithQuery("page", "2").WithHeader("Accept", "text/plain") },
+			func(srv *Server) {
+				srv.Nougat().Get("foo?page=1").Receive(nil, nil)
+				srv.Nougat().Get("foo?page=2").Set("Accept", "text/plain").Receive(nil, nil)
+			},
+			[]string{"nougattest: unexpected GET /foo?page=1:\n\tGET /foo: query page: expected [\"2\"], got [\"1\"]\n\tGET /foo: header Accept: expected \"text/plain\", got []"},
+		},
+		{
+			func(srv *Server) { srv.Expect("PUT", "/foo").WithJSON(map[string]int{"a": 1}) },
+			func(srv *Server) {
+				srv.Nougat().Put("foo").BodyJSON(map[string]int{"a": 2}).Receive(nil, nil)
+				srv.Nougat().Put("foo").BodyJSON(map[string]int{"a": 1}).Receive(nil, nil)
+			},
+			[]string{"nougattest: unexpected PUT /foo:\n\tPUT /foo: body: expected {\"a\":1}, got {\"a\":2}"},
+		},
+	}
+	for _, c := range cases {
+		rt := &recordingT{TB: t}
+		srv := NewServer(rt)
+		c.setup(srv)
+		c.send(srv)
+		errors := rt.finish()
+		if strings.Join(errors, "|") != strings.Join(c.expectedErrors, "|") {
+			t.Errorf("expected %q, got %q", c.expectedErrors, errors)
+		}
+	}
+}
+
+func TestExpectation_responses(t *testing.T) {
+	srv := NewServer(t)
+	e := srv.Expect("GET", "/status").
+		Respond(503, "busy").
+		Respond(200, []byte("ok"))
+
+	expected := []struct {
+		statusCode int
+		body       string
+	}{
+		{503, "busy"},
+		{200, "ok"},
+		// the last response repeats
+		{200, "ok"},
+	}
+	for _, c := range expected {
+		req, _ := srv.Nougat().Get("status").Request()
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != c.statusCode || string(body) != c.body {
+			t.Errorf("expected %d %s, got %d %s", c.statusCode, c.body, resp.StatusCode, body)
+		}
+	}
+	if calls := e.Calls(); calls != 3 {
+		t.Errorf("expected %d calls, got %d", 3, calls)
+	}
+}
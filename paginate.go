@@ -0,0 +1,394 @@
+package nougat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// PageStrategy finds the page following a response of a paginated API.
+type PageStrategy interface {
+	// NextPage returns the URL of the page following the response to req, or
+	// nil if the response was the last page. body is the response body and
+	// items the number of items decoded from it.
+	NextPage(req *http.Request, resp *http.Response, body []byte, items int) (*url.URL, error)
+}
+
+// PageOptions configures a paginated listing.
+type PageOptions struct {
+	// MaxPages caps the number of pages fetched. Zero means no limit.
+	MaxPages int
+	// ItemsPath is the dot-separated path of the JSON array of items in
+	// each page, such as "data.items". If empty, each page body is decoded as
+	// the array of items with the Nougat's response decoder.
+	ItemsPath string
+}
+
+// Pages iterates over the items of a paginated listing, fetching pages as
+// needed. For example,
+//
+//	pages := nougat.Paginate[Order](ctx, api.New().Get("orders"), nougat.LinkPagination(), nougat.PageOptions{})
+//	for pages.Next() {
+//		order := pages.Item()
+//		...
+//	}
+//	if err := pages.Err(); err != nil {
+//		...
+//	}
+//
+// Non-2XX responses stop the iteration with an *HTTPError.
+type Pages[T any] struct {
+	ctx      context.Context
+	nougat   *Nougat
+	strategy PageStrategy
+	options  PageOptions
+
+	next  *url.URL
+	pages int
+	items []T
+	index int
+	item  T
+	done  bool
+	err   error
+}
+
+// Paginate returns an iterator over the items of the paginated listing
+// which starts with the request built by the Nougat. Following pages are
+// found with the given strategy.
+func Paginate[T any](ctx context.Context, n *Nougat, strategy PageStrategy, options PageOptions) *Pages[T] {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &Pages[T]{ctx: ctx, nougat: n, strategy: strategy, options: options}
+}
+
+// Next advances to the next item, fetching the next page when the items of
+// the current page are exhausted. It returns false when there are no more
+// items, when MaxPages is reached, or on error.
+func (p *Pages[T]) Next() bool {
+	for p.index >= len(p.items) {
+		if p.done || p.err != nil {
+			return false
+		}
+		if p.options.MaxPages > 0 && p.pages >= p.options.MaxPages {
+			p.done = true
+			return false
+		}
+		if p.err = p.ctx.Err(); p.err != nil {
+			return false
+		}
+		if p.err = p.fetch(); p.err != nil {
+			return false
+		}
+	}
+	if p.err = p.ctx.Err(); p.err != nil {
+		return false
+	}
+	p.item = p.items[p.index]
+	p.index++
+	return true
+}
+
+// Item returns the current item.
+func (p *Pages[T]) Item() T {
+	return p.item
+}
+
+// Pages returns the number of pages fetched so far.
+func (p *Pages[T]) Pages() int {
+	return p.pages
+}
+
+// Err returns the first error fetching or decoding a page, or the context's
+// error if the iteration was cancelled.
+func (p *Pages[T]) Err() error {
+	return p.err
+}
+
+// fetch requests the next page and decodes its items.
+func (p *Pages[T]) fetch() error {
+	n := p.nougat
+	if p.next != nil {
+		// the next page URL already has the query parameters
+		n = n.New()
+		n.rawURL = p.next.String()
+		n.placeholders = nil
+		n.queryStructs = nil
+	}
+	req, err := n.RequestContext(p.ctx)
+	if err != nil {
+		return err
+	}
+	resp, err := n.doer().Do(req)
+	if err != nil {
+		return err
+	}
+	decompressResponse(resp)
+	body, err := ioutil.ReadAll(contextReader{ctx: p.ctx, r: resp.Body})
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	p.pages++
+
+	if !isSuccess(resp.StatusCode) {
+		return newHTTPError(req, resp, nil, nil)
+	}
+
+	var items []T
+	if resp.StatusCode != http.StatusNoContent && len(bytes.TrimSpace(body)) > 0 {
+		if items, err = p.decodeItems(n, resp, body); err != nil {
+			return err
+		}
+	}
+	p.items, p.index = items, 0
+
+	next, err := p.strategy.NextPage(req, resp, body, len(items))
+	if err != nil {
+		return err
+	}
+	p.next = next
+	p.done = next == nil
+	return nil
+}
+
+// decodeItems decodes the items of the page from the body at ItemsPath, or
+// from the whole body with the Nougat's response decoder.
+func (p *Pages[T]) decodeItems(n *Nougat, resp *http.Response, body []byte) ([]T, error) {
+	var items []T
+	if p.options.ItemsPath != "" {
+		raw, err := jsonPath(body, p.options.ItemsPath)
+		if err != nil || raw == nil {
+			return nil, err
+		}
+		err = json.Unmarshal(raw, &items)
+		return items, err
+	}
+	decoder, err := n.decoderFor(resp)
+	if err != nil {
+		return nil, err
+	}
+	err = decoder.Decode(resp, &items)
+	return items, err
+}
+
+// jsonPath returns the JSON value at the dot-separated path of object keys
+// in data, or nil if there is no value at the path.
+func jsonPath(data []byte, path string) (json.RawMessage, error) {
+	raw := json.RawMessage(data)
+	for _, key := range splitPath(path) {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return nil, err
+		}
+		value, ok := object[key]
+		if !ok {
+			return nil, nil
+		}
+		raw = value
+	}
+	if string(bytes.TrimSpace(raw)) == "null" {
+		return nil, nil
+	}
+	return raw, nil
+}
+
+// splitPath splits a dot-separated key path, ignoring empty keys.
+func splitPath(path string) []string {
+	var keys []string
+	for _, key := range strings.Split(path, ".") {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+/********************************** LINK HEADER *********************************************/
+
+// LinkPagination returns a PageStrategy which follows the RFC 8288
+// `Link: <url>; rel="next"` response header. Links to another origin
+// (scheme and host) are refused with an error, so the request's
+// credentials aren't sent to it.
+func LinkPagination() PageStrategy {
+	return linkPagination{}
+}
+
+type linkPagination struct{}
+
+func (linkPagination) NextPage(req *http.Request, resp *http.Response, body []byte, items int) (*url.URL, error) {
+	for _, link := range parseLinks(resp.Header.Values("Link")) {
+		for _, rel := range strings.Fields(link.params["rel"]) {
+			if strings.EqualFold(rel, "next") {
+				next, err := url.Parse(link.target)
+				if err != nil {
+					return nil, err
+				}
+				next = req.URL.ResolveReference(next)
+				if !strings.EqualFold(next.Scheme, req.URL.Scheme) || !strings.EqualFold(next.Host, req.URL.Host) {
+					return nil, errors.New("nougat: next page link " + next.Redacted() + " is cross-origin")
+				}
+				return next, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// link is a link value of an RFC 8288 Link header.
+type link struct {
+	target string
+	params map[string]string
+}
+
+// parseLinks parses the links in Link header values, skipping malformed
+// links. Parameter names are lower-cased.
+func parseLinks(values []string) []link {
+	var links []link
+	for _, value := range values {
+		for {
+			start := strings.IndexByte(value, '<')
+			if start < 0 {
+				break
+			}
+			end := strings.IndexByte(value[start:], '>')
+			if end < 0 {
+				break
+			}
+			l := link{target: value[start+1 : start+end], params: map[string]string{}}
+			value = value[start+end+1:]
+
+			// parameters run until a comma outside of a quoted string
+			var params string
+			params, value = splitLinkParams(value)
+			for _, param := range strings.Split(params, ";") {
+				name, paramValue, _ := strings.Cut(param, "=")
+				name = strings.ToLower(strings.TrimSpace(name))
+				if name != "" {
+					l.params[name] = strings.Trim(strings.TrimSpace(paramValue), `"`)
+				}
+			}
+			links = append(links, l)
+		}
+	}
+	return links
+}
+
+// splitLinkParams splits s at the first comma outside a quoted string.
+func splitLinkParams(s string) (params, rest string) {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			quoted = !quoted
+		case ',':
+			if !quoted {
+				return s[:i], s[i+1:]
+			}
+		}
+	}
+	return s, ""
+}
+
+/********************************** CURSOR *********************************************/
+
+// CursorPagination returns a PageStrategy which reads the cursor of the next
+// page from the JSON response body at the dot-separated cursorPath, such as
+// "meta.next_cursor", and sends it as the url query parameter param. The
+// listing ends when the cursor is missing, null or empty. A cursor equal to
+// the one of the request is an error, since the listing would never end.
+func CursorPagination(param, cursorPath string) PageStrategy {
+	return cursorPagination{param: param, path: cursorPath}
+}
+
+type cursorPagination struct {
+	param string
+	path  string
+}
+
+func (c cursorPagination) NextPage(req *http.Request, resp *http.Response, body []byte, items int) (*url.URL, error) {
+	raw, err := jsonPath(body, c.path)
+	if err != nil || raw == nil {
+		return nil, err
+	}
+	var cursor interface{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	if err := decoder.Decode(&cursor); err != nil {
+		return nil, err
+	}
+	var value string
+	switch v := cursor.(type) {
+	case string:
+		value = v
+	case json.Number:
+		value = v.String()
+	default:
+		return nil, errors.New("nougat: pagination cursor " + c.path + " is not a string or number")
+	}
+	if value == "" {
+		return nil, nil
+	}
+	if value == req.URL.Query().Get(c.param) {
+		return nil, errors.New("nougat: pagination cursor " + c.path + " didn't change")
+	}
+	return withQueryParam(req.URL, c.param, value), nil
+}
+
+/********************************** PAGE NUMBER AND OFFSET *********************************************/
+
+// PagePagination returns a PageStrategy which increments the page number in
+// the url query parameter param, starting from first when the first request
+// has no such parameter. The listing ends with the first empty page.
+func PagePagination(param string, first int) PageStrategy {
+	return counterPagination{param: param, first: first}
+}
+
+// OffsetPagination returns a PageStrategy which advances the offset in the
+// url query parameter param by the number of items in each page, starting
+// from 0. The listing ends with the first empty page.
+func OffsetPagination(param string) PageStrategy {
+	return counterPagination{param: param, offset: true}
+}
+
+// counterPagination increments a numeric query parameter by one page or by
+// the number of items in the page.
+type counterPagination struct {
+	param  string
+	first  int
+	offset bool
+}
+
+func (c counterPagination) NextPage(req *http.Request, resp *http.Response, body []byte, items int) (*url.URL, error) {
+	if items == 0 {
+		return nil, nil
+	}
+	current := c.first
+	if value := req.URL.Query().Get(c.param); value != "" {
+		var err error
+		if current, err = strconv.Atoi(value); err != nil {
+			return nil, err
+		}
+	}
+	next := current + 1
+	if c.offset {
+		next = current + items
+	}
+	return withQueryParam(req.URL, c.param, strconv.Itoa(next)), nil
+}
+
+// withQueryParam returns a copy of u with the query parameter set to value.
+func withQueryParam(u *url.URL, param, value string) *url.URL {
+	next := *u
+	query := next.Query()
+	query.Set(param, value)
+	next.RawQuery = query.Encode()
+	return &next
+}
@@ -0,0 +1,270 @@
+package nougat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// collect returns the text of every item of the pages.
+func collect(pages *Pages[FakeModel]) []string {
+	var texts []string
+	for pages.Next() {
+		texts = append(texts, pages.Item().Text)
+	}
+	return texts
+}
+
+func TestPaginate_link(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {
+		assertMethod(t, "GET", r)
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Query().Get("page") {
+		case "":
+			if limit := r.URL.Query().Get("limit"); limit != "30" {
+				t.Errorf("expected limit 30, got %s", limit)
+			}
+			w.Header().Add("Link", `<http://example.com/items?page=2>; rel="next", <http://example.com/items?page=3>; rel="last"`)
+			fmt.Fprintf(w, `[{"text": "a"}, {"text": "b"}]`)
+		case "2":
+			w.Header().Add("Link", `</items?page=1>; rel="prev first"`)
+			w.Header().Add("Link", `</items?page=3>; title="a, b"; rel="next"`)
+			fmt.Fprintf(w, `[{"text": "c"}]`)
+		case "3":
+			fmt.Fprintf(w, `[{"text": "d"}]`)
+		}
+	})
+
+	pages := Paginate[FakeModel](context.Background(), New().Client(client).Get("http://example.com/items").QueryStruct(paramsA), LinkPagination(), PageOptions{})
+	expected := []string{"a", "b", "c", "d"}
+	if texts := collect(pages); !reflect.DeepEqual(expected, texts) {
+		t.Errorf("expected %v, got %v", expected, texts)
+	}
+	if err := pages.Err(); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if pages.Pages() != 3 {
+		t.Errorf("expected %d pages, got %d", 3, pages.Pages())
+	}
+}
+
+func TestPaginate_crossOriginLink(t *testing.T) {
+	var requests int
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		header := http.Header{"Link": {`<https://evil.example.com/items?page=2>; rel="next"`}}
+		return &http.Response{StatusCode: 200, Header: header, Body: ioutil.NopCloser(strings.NewReader(`[{"text": "a"}]`)), Request: req}, nil
+	})
+
+	pages := Paginate[FakeModel](context.Background(), New().Doer(doer).Get("https://example.com/items").SetBasicAuth("key", "secret"), LinkPagination(), PageOptions{})
+	if texts := collect(pages); texts != nil {
+		t.Errorf("expected no items, got %v", texts)
+	}
+	if err := pages.Err(); err == nil || !strings.Contains(err.Error(), "cross-origin") {
+		t.Errorf("expected a cross-origin error, got %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("expected %d requests, got %d", 1, requests)
+	}
+}
+
+func TestPaginate_cursor(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			fmt.Fprintf(w, `{"data": {"items": [{"text": "a"}]}, "meta": {"next": "xyz"}}`)
+		case "xyz":
+			fmt.Fprintf(w, `{"data": {"items": [{"text": "b"}, {"text": "c"}]}, "meta": {"next": 42}}`)
+		case "42":
+			fmt.Fprintf(w, `{"data": {"items": []}, "meta": {"next": null}}`)
+		}
+	})
+
+	pages := Paginate[FakeModel](context.Background(), New().Client(client).Get("http://example.com/items"),
+		CursorPagination("cursor", "meta.next"), PageOptions{ItemsPath: "data.items"})
+	expected := []string{"a", "b", "c"}
+	if texts := collect(pages); !reflect.DeepEqual(expected, texts) {
+		t.Errorf("expected %v, got %v", expected, texts)
+	}
+	if err := pages.Err(); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+}
+
+func TestPaginate_unchangedCursor(t *testing.T) {
+	var requests int
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		requests++
+		body := `{"items": [{"text": "a"}], "next": "c1"}`
+		return &http.Response{StatusCode: 200, Header: http.Header{}, Body: ioutil.NopCloser(strings.NewReader(body)), Request: req}, nil
+	})
+
+	pages := Paginate[FakeModel](context.Background(), New().Doer(doer).Get("http://example.com/items"),
+		CursorPagination("cursor", "next"), PageOptions{ItemsPath: "items"})
+	expected := []string{"a"}
+	if texts := collect(pages); !reflect.DeepEqual(expected, texts) {
+		t.Errorf("expected %v, got %v", expected, texts)
+	}
+	if err := pages.Err(); err == nil || err.Error() != "nougat: pagination cursor next didn't change" {
+		t.Errorf("expected an unchanged cursor error, got %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("expected %d requests, got %d", 2, requests)
+	}
+}
+
+func TestPaginate_pageNumberAndOffset(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	// serves items 0..4 in pages of two
+	serve := func(w http.ResponseWriter, start int) {
+		var items []string
+		for i := start; i < start+2 && i < 5; i++ {
+			items = append(items, fmt.Sprintf(`{"text": "%d"}`, i))
+		}
+		fmt.Fprintf(w, "[")
+		for i, item := range items {
+			if i > 0 {
+				fmt.Fprintf(w, ",")
+			}
+			fmt.Fprintf(w, "%s", item)
+		}
+		fmt.Fprintf(w, "]")
+	}
+	mux.HandleFunc("/pages", func(w http.ResponseWriter, r *http.Request) {
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil {
+			page = 1
+		}
+		serve(w, (page-1)*2)
+	})
+	mux.HandleFunc("/offsets", func(w http.ResponseWriter, r *http.Request) {
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		serve(w, offset)
+	})
+
+	api := New().Client(client).Base("http://example.com/")
+	cases := []struct {
+		pages    *Pages[FakeModel]
+		expected []string
+	}{
+		{Paginate[FakeModel](context.Background(), api.New().Get("pages"), PagePagination("page", 1), PageOptions{}), []string{"0", "1", "2", "3", "4"}},
+		{Paginate[FakeModel](context.Background(), api.New().Get("offsets"), OffsetPagination("offset"), PageOptions{}), []string{"0", "1", "2", "3", "4"}},
+		// MaxPages caps the number of pages
+		{Paginate[FakeModel](context.Background(), api.New().Get("pages"), PagePagination("page", 1), PageOptions{MaxPages: 2}), []string{"0", "1", "2", "3"}},
+	}
+	for _, c := range cases {
+		if texts := collect(c.pages); !reflect.DeepEqual(c.expected, texts) {
+			t.Errorf("expected %v, got %v", c.expected, texts)
+		}
+		if err := c.pages.Err(); err != nil {
+			t.Errorf("expected nil, got %v", err)
+		}
+	}
+}
+
+func TestPaginate_contextCanceled(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	var requests int
+	mux.HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprintf(w, `[{"text": "a"}, {"text": "b"}]`)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pages := Paginate[FakeModel](ctx, New().Client(client).Get("http://example.com/items"), PagePagination("page", 1), PageOptions{})
+	if !pages.Next() {
+		t.Fatalf("expected an item, got %v", pages.Err())
+	}
+	cancel()
+	if pages.Next() {
+		t.Errorf("expected iteration to stop after cancel")
+	}
+	if pages.Err() != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, pages.Err())
+	}
+	if requests != 1 {
+		t.Errorf("expected %d request, got %d", 1, requests)
+	}
+}
+
+func TestPaginate_failure(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") == "2" {
+			w.WriteHeader(500)
+			fmt.Fprintf(w, "oops")
+			return
+		}
+		fmt.Fprintf(w, `[{"text": "a"}]`)
+	})
+
+	pages := Paginate[FakeModel](context.Background(), New().Client(client).Get("http://example.com/items"), PagePagination("page", 1), PageOptions{})
+	if texts := collect(pages); !reflect.DeepEqual([]string{"a"}, texts) {
+		t.Errorf("expected [a], got %v", texts)
+	}
+	var httpErr *HTTPError
+	if !errors.As(pages.Err(), &httpErr) || httpErr.StatusCode != 500 || string(httpErr.Body) != "oops" {
+		t.Errorf("expected a 500 *HTTPError, got %v", pages.Err())
+	}
+}
+
+func TestParseLinks(t *testing.T) {
+	links := parseLinks([]string{
+		`<https://a.io/?page=2>; rel="next"; title="x, y", <https://a.io/?page=9>; REL=last`,
+		`malformed, <https://a.io/?page=1>;rel=prev`,
+	})
+	expected := []link{
+		{"https://a.io/?page=2", map[string]string{"rel": "next", "title": "x, y"}},
+		{"https://a.io/?page=9", map[string]string{"rel": "last"}},
+		{"https://a.io/?page=1", map[string]string{"rel": "prev"}},
+	}
+	if !reflect.DeepEqual(expected, links) {
+		t.Errorf("expected %v, got %v", expected, links)
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	data := []byte(`{"a": {"b": [1, 2]}, "c": null}`)
+	cases := []struct {
+		path     string
+		expected string
+	}{
+		{"a.b", "[1, 2]"},
+		{"a", `{"b": [1, 2]}`},
+		{"c", ""},
+		{"missing", ""},
+		{"a.missing", ""},
+	}
+	for _, c := range cases {
+		raw, err := jsonPath(data, c.path)
+		if err != nil || string(raw) != c.expected {
+			t.Errorf("%s: expected %s, got %s, %v", c.path, c.expected, raw, err)
+		}
+	}
+	if _, err := jsonPath(data, "a.b.c"); err == nil {
+		t.Errorf("expected an error indexing an array")
+	}
+}
+
+func TestCounterPagination_invalidParam(t *testing.T) {
+	u, _ := url.Parse("http://a.io/?page=first")
+	_, err := PagePagination("page", 1).NextPage(&http.Request{URL: u}, nil, nil, 1)
+	if err == nil {
+		t.Errorf("expected an error for a non-numeric page")
+	}
+}
@@ -0,0 +1,326 @@
+package nougat
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// epochThreshold separates X-RateLimit-Reset values which are Unix times
+	// from those which are seconds until the reset.
+	epochThreshold = 1e9
+	// epochMillisThreshold separates Unix times in seconds from those in
+	// milliseconds.
+	epochMillisThreshold = 1e12
+	// maxQuotaWait caps the wait for a quota reported by response headers,
+	// so that a bad reset time doesn't block a host's requests for good.
+	maxQuotaWait = time.Hour
+)
+
+// Limit is a token bucket rate limit of Requests per period Per, allowing
+// bursts of up to Burst requests. The zero Limit is unlimited.
+type Limit struct {
+	// Requests is the number of requests allowed Per period.
+	Requests int
+	// Per is the period of Requests.
+	Per time.Duration
+	// Burst is the maximum number of requests sent at once. Defaults to
+	// Requests.
+	Burst int
+}
+
+// unlimited reports whether the limit doesn't restrict requests.
+func (l Limit) unlimited() bool {
+	return l.Requests <= 0 || l.Per <= 0
+}
+
+// RateLimitPolicy configures the limits of a RateLimiter.
+type RateLimitPolicy struct {
+	// Default is the limit of hosts without their own limit. Defaults to
+	// unlimited.
+	Default Limit
+	// Hosts are the limits of requests to each host, such as
+	// "api.safaricom.co.ke".
+	Hosts map[string]Limit
+	// Routes are the limits of requests to each route, keyed by host and
+	// route template (see BreakerKeyRoute), such as
+	// "api.example.com/users/{id}". Requests to a route are limited by both
+	// the route and the host limits.
+	Routes map[string]Limit
+	// IgnoreHeaders disables adapting to the quotas servers report in
+	// X-RateLimit-Remaining and X-RateLimit-Reset, RateLimit-Remaining and
+	// RateLimit-Reset, or RateLimit response headers, and to the
+	// Retry-After header of 429 responses. Waits for a reported quota are
+	// capped at an hour.
+	IgnoreHeaders bool
+}
+
+// RateLimiter limits the rate of requests with token buckets per host and
+// route. Requests wait until a permit is available or their context is
+// done. Unless the policy's IgnoreHeaders is set, a host's requests also
+// wait while the quota reported by its latest response is used up.
+//
+// Use the same RateLimiter for all the Nougats which share a quota, such
+// as by adding its Middleware to a parent Nougat whose children are
+// created with New. A RateLimiter is safe for concurrent use.
+type RateLimiter struct {
+	policy RateLimitPolicy
+
+	mu     sync.Mutex
+	hosts  map[string]*bucket
+	routes map[string]*bucket
+	// now returns the current time
+	now func() time.Time
+	// sleep waits for d or until ctx is done
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewRateLimiter returns a RateLimiter with the given policy.
+func NewRateLimiter(policy RateLimitPolicy) *RateLimiter {
+	return &RateLimiter{
+		policy: policy,
+		hosts:  make(map[string]*bucket),
+		routes: make(map[string]*bucket),
+		now:    time.Now,
+		sleep:  sleepContext,
+	}
+}
+
+// RateLimit returns Middleware which limits requests according to the
+// given policy. See RateLimiter. Requests sent through the Middleware, by
+// a Nougat and its children, share its limits.
+func RateLimit(policy RateLimitPolicy) Middleware {
+	return NewRateLimiter(policy).Middleware()
+}
+
+// Middleware returns Middleware which waits for a permit from the
+// RateLimiter before sending each request to the next Doer, and adapts to
+// the quota headers of its response.
+func (l *RateLimiter) Middleware() Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if err := l.Wait(req.Context(), req); err != nil {
+				return nil, err
+			}
+			resp, err := next.Do(req)
+			if err == nil && !l.policy.IgnoreHeaders {
+				l.observe(req, resp)
+			}
+			return resp, err
+		})
+	}
+}
+
+// Wait blocks until the request is permitted by its host and route limits,
+// or the context is done, in which case the context's error is returned.
+func (l *RateLimiter) Wait(ctx context.Context, req *http.Request) error {
+	// a done context mustn't use up a token
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	now := l.now()
+	buckets := []*bucket{l.hostBucket(req.URL.Host, now)}
+	if route, ok := l.routeBucket(BreakerKeyRoute(req), now); ok {
+		buckets = append(buckets, route)
+	}
+	var wait time.Duration
+	quotas := make([]time.Time, len(buckets))
+	for i, b := range buckets {
+		d, quota := b.reserve(now)
+		if d > wait {
+			wait = d
+		}
+		quotas[i] = quota
+	}
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return ctx.Err()
+	}
+	if err := l.sleep(ctx, wait); err != nil {
+		l.mu.Lock()
+		for i, b := range buckets {
+			b.cancel(quotas[i])
+		}
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// hostBucket returns the bucket of the host, creating it if needed.
+func (l *RateLimiter) hostBucket(host string, now time.Time) *bucket {
+	b, ok := l.hosts[host]
+	if !ok {
+		limit, ok := l.policy.Hosts[host]
+		if !ok {
+			limit = l.policy.Default
+		}
+		b = newBucket(limit, now)
+		l.hosts[host] = b
+	}
+	return b
+}
+
+// routeBucket returns the bucket of the route, if it has a limit.
+func (l *RateLimiter) routeBucket(route string, now time.Time) (*bucket, bool) {
+	b, ok := l.routes[route]
+	if !ok {
+		limit, ok := l.policy.Routes[route]
+		if !ok {
+			return nil, false
+		}
+		b = newBucket(limit, now)
+		l.routes[route] = b
+	}
+	return b, true
+}
+
+// observe updates the request host's quota from the response headers.
+func (l *RateLimiter) observe(req *http.Request, resp *http.Response) {
+	now := l.now()
+	remaining, reset, ok := parseRateLimitHeaders(resp.Header, now)
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if wait, found := retryAfter(resp, now); found {
+			remaining, reset, ok = 0, now.Add(wait), true
+		}
+	}
+	if !ok {
+		return
+	}
+	if reset.Sub(now) > maxQuotaWait {
+		reset = now.Add(maxQuotaWait)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.hostBucket(req.URL.Host, now)
+	b.remaining, b.reset = remaining, reset
+}
+
+// bucket is a token bucket and the server quota of a host or route.
+type bucket struct {
+	// rate is the number of tokens added per second, or 0 if unlimited
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	// remaining requests of the server quota until reset, if reset is set
+	remaining int
+	reset     time.Time
+}
+
+// newBucket returns a full bucket for the limit.
+func newBucket(limit Limit, now time.Time) *bucket {
+	if limit.unlimited() {
+		return &bucket{}
+	}
+	burst := limit.Burst
+	if burst <= 0 {
+		burst = limit.Requests
+	}
+	return &bucket{
+		rate:   float64(limit.Requests) / limit.Per.Seconds(),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// reserve takes a token and returns how long to wait before using it.
+// Tokens may be reserved ahead of time, so waits are first come, first
+// served. quota is the reset time of the server quota a request was taken
+// from, if any.
+func (b *bucket) reserve(now time.Time) (wait time.Duration, quota time.Time) {
+	if b.rate > 0 {
+		if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+			b.tokens += elapsed * b.rate
+			if b.tokens > b.burst {
+				b.tokens = b.burst
+			}
+			b.last = now
+		}
+		b.tokens--
+		if b.tokens < 0 {
+			wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+		}
+	}
+	if !b.reset.IsZero() {
+		switch {
+		case !now.Before(b.reset):
+			// the quota was renewed
+			b.reset = time.Time{}
+		case b.remaining > 0:
+			b.remaining--
+			quota = b.reset
+		default:
+			if d := b.reset.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait, quota
+}
+
+// cancel returns the token of a reservation which won't be used, and the
+// request it took from the server quota, unless the quota has since been
+// renewed or replaced.
+func (b *bucket) cancel(quota time.Time) {
+	if b.rate > 0 {
+		b.tokens++
+	}
+	if !quota.IsZero() && b.reset.Equal(quota) {
+		b.remaining++
+	}
+}
+
+// parseRateLimitHeaders returns the remaining requests and reset time of
+// the quota reported by X-RateLimit-*, RateLimit-* or RateLimit response
+// headers.
+func parseRateLimitHeaders(header http.Header, now time.Time) (remaining int, reset time.Time, ok bool) {
+	remainingValue, resetValue := header.Get("RateLimit-Remaining"), header.Get("RateLimit-Reset")
+	if remainingValue == "" {
+		remainingValue, resetValue = header.Get("X-RateLimit-Remaining"), header.Get("X-RateLimit-Reset")
+	}
+	if remainingValue == "" {
+		remainingValue, resetValue = parseRateLimitField(header.Get("RateLimit"))
+	}
+	remaining, err := strconv.Atoi(strings.TrimSpace(remainingValue))
+	if err != nil {
+		return 0, time.Time{}, false
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(resetValue), 64)
+	if err != nil || value < 0 {
+		return 0, time.Time{}, false
+	}
+	switch {
+	case value >= epochMillisThreshold:
+		reset = time.Unix(0, int64(value*float64(time.Millisecond)))
+	case value >= epochThreshold:
+		reset = time.Unix(0, int64(value*float64(time.Second)))
+	default:
+		reset = now.Add(time.Duration(value * float64(time.Second)))
+	}
+	return remaining, reset, true
+}
+
+// parseRateLimitField returns the remaining and reset values of a RateLimit
+// header, in the form "limit=100, remaining=50, reset=30" or
+// `"default";r=50;t=30`.
+func parseRateLimitField(value string) (remaining, reset string) {
+	for _, param := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ';' }) {
+		name, val := splitPair(strings.TrimSpace(param), "=")
+		switch strings.ToLower(name) {
+		case "r", "remaining":
+			remaining = val
+		case "t", "reset":
+			reset = val
+		}
+	}
+	return remaining, reset
+}
@@ -0,0 +1,161 @@
+package nougat
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// newTestRateLimiter returns a RateLimiter using the clock, whose sleeps
+// advance the clock and are recorded in waits.
+func newTestRateLimiter(policy RateLimitPolicy, clock *fakeClock, waits *[]time.Duration) *RateLimiter {
+	limiter := NewRateLimiter(policy)
+	limiter.now = clock.Now
+	limiter.sleep = func(ctx context.Context, d time.Duration) error {
+		*waits = append(*waits, d)
+		clock.Advance(d)
+		return ctx.Err()
+	}
+	return limiter
+}
+
+func TestRateLimiter_limits(t *testing.T) {
+	policy := RateLimitPolicy{
+		Default: Limit{Requests: 2, Per: time.Second},
+		Hosts:   map[string]Limit{"b.io": {Requests: 1, Per: time.Second}},
+		Routes:  map[string]Limit{"a.io/users/{id}": {Requests: 1, Per: 2 * time.Second}},
+	}
+	cases := []struct {
+		requests      []*Nougat
+		expectedWaits []time.Duration
+	}{
+		// bursts of up to 2, then one every 500ms
+		{[]*Nougat{New().Get("http://a.io/"), New().Get("http://a.io/"), New().Get("http://a.io/"), New().Get("http://a.io/")},
+			[]time.Duration{500 * time.Millisecond, 500 * time.Millisecond}},
+		{[]*Nougat{New().Get("http://b.io/"), New().Get("http://b.io/")},
+			[]time.Duration{time.Second}},
+		// hosts have their own buckets
+		{[]*Nougat{New().Get("http://a.io/"), New().Get("http://b.io/"), New().Get("http://c.io/")}, nil},
+		// routes are limited by both the route and host
+		{[]*Nougat{New().Get("http://a.io/users/{id}").PathParam("id", "1"), New().Get("http://a.io/users/{id}").PathParam("id", "2")},
+			[]time.Duration{2 * time.Second}},
+		{[]*Nougat{New().Get("http://a.io/users/{id}").PathParam("id", "1"), New().Get("http://a.io/other"), New().Get("http://a.io/other")},
+			[]time.Duration{500 * time.Millisecond}},
+	}
+	for i, c := range cases {
+		clock := &fakeClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+		var waits []time.Duration
+		limiter := newTestRateLimiter(policy, clock, &waits)
+		for _, n := range c.requests {
+			req, _ := n.Request()
+			if err := limiter.Wait(req.Context(), req); err != nil {
+				t.Errorf("%d: expected nil, got %v", i, err)
+			}
+		}
+		if !reflect.DeepEqual(c.expectedWaits, waits) {
+			t.Errorf("%d: expected waits %v, got %v", i, c.expectedWaits, waits)
+		}
+	}
+}
+
+func TestRateLimiter_canceled(t *testing.T) {
+	limiter := NewRateLimiter(RateLimitPolicy{Default: Limit{Requests: 1, Per: time.Hour}})
+	req, _ := New().Get("http://a.io/").Request()
+	if err := limiter.Wait(context.Background(), req); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	b := limiter.hosts["a.io"]
+	b.remaining, b.reset = 5, time.Now().Add(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := limiter.Wait(ctx, req); err != context.DeadlineExceeded {
+		t.Errorf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected Wait to return when the context is done, took %v", elapsed)
+	}
+	// the cancelled reservation is returned, including its server quota
+	if b.tokens < 0 || b.remaining != 5 {
+		t.Errorf("expected the reservation to be returned, got %v tokens and %d remaining", b.tokens, b.remaining)
+	}
+
+	// done contexts don't reserve
+	limiter = NewRateLimiter(RateLimitPolicy{Default: Limit{Requests: 1, Per: time.Hour}})
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.Wait(ctx, req); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if err := limiter.Wait(context.Background(), req); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if tokens := limiter.hosts["a.io"].tokens; tokens != 0 {
+		t.Errorf("expected %v tokens, got %v", 0, tokens)
+	}
+}
+
+func TestRateLimiter_headers(t *testing.T) {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	cases := []struct {
+		statusCode    int
+		header        http.Header
+		expectedWaits []time.Duration
+	}{
+		// a remaining quota doesn't wait
+		{200, http.Header{"X-Ratelimit-Remaining": {"1"}, "X-Ratelimit-Reset": {"30"}}, nil},
+		{200, http.Header{"Ratelimit-Remaining": {"2"}, "Ratelimit-Reset": {"10"}}, nil},
+		{200, http.Header{"Ratelimit": {`"default";r=1;t=20`}}, nil},
+		// a used up quota waits until its reset, relative or a Unix time
+		{200, http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"30"}}, []time.Duration{30 * time.Second, 30 * time.Second}},
+		{200, http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {strconv.FormatInt(start.Add(time.Minute).Unix(), 10)}}, []time.Duration{time.Minute}},
+		{200, http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {strconv.FormatInt(start.Add(time.Minute).UnixMilli(), 10)}}, []time.Duration{time.Minute}},
+		{200, http.Header{"Ratelimit": {"limit=100, remaining=0, reset=5"}}, []time.Duration{5 * time.Second, 5 * time.Second}},
+		// waits are capped
+		{200, http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"86400"}}, []time.Duration{time.Hour, time.Hour}},
+		{429, http.Header{"Retry-After": {"7"}}, []time.Duration{7 * time.Second, 7 * time.Second}},
+		{200, http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"soon"}}, nil},
+	}
+	for i, c := range cases {
+		clock := &fakeClock{now: start}
+		var waits []time.Duration
+		limiter := newTestRateLimiter(RateLimitPolicy{}, clock, &waits)
+		doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: c.statusCode, Header: c.header, Body: http.NoBody, Request: req}, nil
+		})
+		// each response replaces the quota
+		for j := 0; j < 3; j++ {
+			New().Doer(doer).Use(limiter.Middleware()).Get("http://a.io/").Receive(nil, nil)
+		}
+		if !reflect.DeepEqual(c.expectedWaits, waits) {
+			t.Errorf("%d: expected waits %v, got %v", i, c.expectedWaits, waits)
+		}
+
+		// headers are ignored if disabled
+		waits = nil
+		limiter = newTestRateLimiter(RateLimitPolicy{IgnoreHeaders: true}, clock, &waits)
+		for j := 0; j < 3; j++ {
+			New().Doer(doer).Use(limiter.Middleware()).Get("http://a.io/").Receive(nil, nil)
+		}
+		if waits != nil {
+			t.Errorf("%d: expected no waits, got %v", i, waits)
+		}
+	}
+}
+
+func TestRateLimit_sharedByChildren(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	var waits []time.Duration
+	limiter := newTestRateLimiter(RateLimitPolicy{Default: Limit{Requests: 1, Per: time.Second}}, clock, &waits)
+	parent := New().Doer(&statusDoer{statuses: []int{200}}).Base("http://a.io/").Use(limiter.Middleware())
+	parent.New().Get("users").Receive(nil, nil)
+	parent.New().Get("orders").Receive(nil, nil)
+	parent.New().New().Post("orders").Receive(nil, nil)
+	expected := []time.Duration{time.Second, time.Second}
+	if !reflect.DeepEqual(expected, waits) {
+		t.Errorf("expected waits %v, got %v", expected, waits)
+	}
+}
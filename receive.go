@@ -1,6 +1,9 @@
 package nougat
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+)
 
 // ReceiveSuccess creates a new HTTP request and returns the response. Success
 // responses (2XX) are JSON decoded into the value pointed to by successV.
@@ -18,7 +21,15 @@ func (r *Nougat) ReceiveSuccess(successV interface{}) (*http.Response, error) {
 // returned.
 // Receive is shorthand for calling Request and Do.
 func (r *Nougat) Receive(successV, failureV interface{}) (*http.Response, error) {
-	req, err := r.Request()
+	return r.ReceiveContext(r.context(), successV, failureV)
+}
+
+// ReceiveContext is like Receive, but creates the request with the given
+// context. Cancelling the context aborts building the request, sending it
+// and decoding the response.
+// ReceiveContext is shorthand for calling RequestContext and Do.
+func (r *Nougat) ReceiveContext(ctx context.Context, successV, failureV interface{}) (*http.Response, error) {
+	req, err := r.RequestContext(ctx)
 	if err != nil {
 		return nil, err
 	}
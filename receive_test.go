@@ -46,6 +46,38 @@ func TestReceive_success_nonDefaultDecoder(t *testing.T) {
 	}
 }
 
+func TestReceive_xml(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/foo/submit", func(w http.ResponseWriter, r *http.Request) {
+		assertMethod(t, "POST", r)
+		if value := r.Header.Get("Content-Type"); value != xmlContentType {
+			t.Errorf("expected %s, got %s", xmlContentType, value)
+		}
+		var model FakeModel
+		if err := xml.NewDecoder(r.Body).Decode(&model); err != nil || model != modelA {
+			t.Errorf("expected XML body %v, got %v, %v", modelA, model, err)
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprintf(w, `<response><text>Some text</text><favorite_count>24</favorite_count></response>`)
+	})
+
+	endpoint := New().Client(client).Base("http://example.com/").Path("foo/").Post("submit")
+
+	model := new(FakeModel)
+	resp, err := endpoint.New().BodyXML(modelA).ResponseDecoder(XMLDecoder()).Receive(model, nil)
+	if err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("expected %d, got %d", 200, resp.StatusCode)
+	}
+	expectedModel := &FakeModel{Text: "Some text", FavoriteCount: 24}
+	if !reflect.DeepEqual(expectedModel, model) {
+		t.Errorf("expected %v, got %v", expectedModel, model)
+	}
+}
+
 func TestReceive_success(t *testing.T) {
 	client, mux, server := testServer()
 	defer server.Close()
@@ -0,0 +1,289 @@
+package nougat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// Records iterates over the JSON records of a response body, decoding one
+// record at a time so large responses aren't held in memory. The response
+// is read only as records are requested, so a slow consumer applies
+// backpressure to the server. For example,
+//
+//	records := nougat.ReceiveNDJSON[Transaction](ctx, api.New().Get("exports/transactions"))
+//	defer records.Close()
+//	for records.Next() {
+//		transaction := records.Item()
+//		...
+//	}
+//	if err := records.Err(); err != nil {
+//		...
+//	}
+//
+// The request is sent by the first call to Next. Non-2XX responses stop the
+// iteration with an *HTTPError, and 204 No Content or empty responses have
+// no records. The Nougat's response decoders aren't used.
+type Records[T any] struct {
+	ctx    context.Context
+	nougat *Nougat
+	// path of the array of records, if not NDJSON
+	path   string
+	ndjson bool
+
+	resp    *http.Response
+	decoder *json.Decoder
+	started bool
+	closed  bool
+	count   int
+	item    T
+	done    bool
+	err     error
+}
+
+// ReceiveNDJSON returns an iterator over the records of the newline
+// delimited JSON (NDJSON, or JSON Lines) response to the request built by
+// the Nougat.
+func ReceiveNDJSON[T any](ctx context.Context, n *Nougat) *Records[T] {
+	return newRecords[T](ctx, n, "", true)
+}
+
+// ReceiveJSONArray returns an iterator over the elements of a JSON array in
+// the response to the request built by the Nougat. The array is the whole
+// body, or the value at the dot-separated path of object keys, such as
+// "data.items". Values before the array are skipped without being decoded
+// and values after it aren't read. A missing or null value at the path has
+// no records.
+func ReceiveJSONArray[T any](ctx context.Context, n *Nougat, path string) *Records[T] {
+	return newRecords[T](ctx, n, path, false)
+}
+
+func newRecords[T any](ctx context.Context, n *Nougat, path string, ndjson bool) *Records[T] {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return &Records[T]{ctx: ctx, nougat: n, path: path, ndjson: ndjson}
+}
+
+// Next decodes the next record, sending the request on the first call. It
+// returns false when there are no more records or on error, closing the
+// response body.
+func (s *Records[T]) Next() bool {
+	if s.done || s.err != nil {
+		return false
+	}
+	if !s.started {
+		s.started = true
+		if s.err = s.open(); s.err != nil || s.done {
+			s.Close()
+			return false
+		}
+	}
+	if s.err = s.ctx.Err(); s.err == nil {
+		var item T
+		if s.next(&item) {
+			s.item = item
+			s.count++
+			return true
+		}
+	}
+	s.Close()
+	return false
+}
+
+// Item returns the current record.
+func (s *Records[T]) Item() T {
+	return s.item
+}
+
+// Count returns the number of records decoded so far.
+func (s *Records[T]) Count() int {
+	return s.count
+}
+
+// Response returns the response the records are read from, or nil if it
+// hasn't been received.
+func (s *Records[T]) Response() *http.Response {
+	return s.resp
+}
+
+// Err returns the first error sending the request or decoding a record, or
+// the context's error if the iteration was cancelled.
+func (s *Records[T]) Err() error {
+	return s.err
+}
+
+// Close stops the iteration and closes the response body. Call it when
+// stopping before Next returns false.
+func (s *Records[T]) Close() error {
+	s.done = true
+	if s.resp == nil || s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.resp.Body.Close()
+}
+
+// ForEach calls fn with each record, stopping at the first error returned
+// by fn. It returns the error of fn or of the iteration, and closes the
+// response body.
+func (s *Records[T]) ForEach(fn func(item T) error) error {
+	defer s.Close()
+	for s.Next() {
+		if err := fn(s.Item()); err != nil {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// open sends the request and positions the decoder at the first record.
+func (s *Records[T]) open() error {
+	req, err := s.nougat.RequestContext(s.ctx)
+	if err != nil {
+		return err
+	}
+	resp, err := s.nougat.doer().Do(req)
+	if err != nil {
+		return err
+	}
+	decompressResponse(resp)
+	s.resp = resp
+	s.decoder = json.NewDecoder(contextReader{ctx: s.ctx, r: resp.Body})
+	if !isSuccess(resp.StatusCode) {
+		return newHTTPError(req, resp, nil, nil)
+	}
+	if resp.StatusCode == http.StatusNoContent || !s.decoder.More() {
+		s.done = true
+		return nil
+	}
+	if s.ndjson {
+		return nil
+	}
+	found, err := seekArray(s.decoder, splitPath(s.path))
+	if err != nil {
+		return fmt.Errorf("nougat: JSON array %q: %w", s.path, err)
+	}
+	s.done = !found
+	return nil
+}
+
+// next decodes the next record into item, returning false when there are no
+// more records or on error.
+func (s *Records[T]) next(item *T) bool {
+	if !s.ndjson && !s.decoder.More() {
+		// the end of the array
+		if _, err := s.decoder.Token(); err != nil {
+			s.err = s.recordErr(err)
+		}
+		return false
+	}
+	if err := s.decoder.Decode(item); err != nil {
+		if !(s.ndjson && err == io.EOF) {
+			s.err = s.recordErr(err)
+		}
+		return false
+	}
+	return true
+}
+
+// recordErr returns an error decoding the next record, or the context's
+// error if it is done.
+func (s *Records[T]) recordErr(err error) error {
+	if ctxErr := s.ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("nougat: record %d: %w", s.count+1, err)
+}
+
+// seekArray reads tokens up to the first element of the array at the path
+// of object keys, returning false if there is no value or null at the path.
+func seekArray(decoder *json.Decoder, path []string) (bool, error) {
+	for _, key := range path {
+		if found, err := seekKey(decoder, key); err != nil || !found {
+			return false, err
+		}
+	}
+	token, err := decoder.Token()
+	switch {
+	case err != nil:
+		return false, err
+	case token == nil:
+		return false, nil
+	case token != json.Delim('['):
+		return false, fmt.Errorf("expected an array, got %s", describeToken(token))
+	}
+	return true, nil
+}
+
+// seekKey reads tokens up to the value of the key in the next object,
+// skipping the values of other keys, and returns false if the object
+// doesn't have the key or is null.
+func seekKey(decoder *json.Decoder, key string) (bool, error) {
+	token, err := decoder.Token()
+	switch {
+	case err != nil:
+		return false, err
+	case token == nil:
+		return false, nil
+	case token != json.Delim('{'):
+		return false, fmt.Errorf("expected an object at %q, got %s", key, describeToken(token))
+	}
+	for decoder.More() {
+		name, err := decoder.Token()
+		if err != nil {
+			return false, err
+		}
+		if name == key {
+			return true, nil
+		}
+		if err := skipValue(decoder); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// skipValue reads the tokens of the next value without decoding it.
+func skipValue(decoder *json.Decoder) error {
+	depth := 0
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
+
+// describeToken describes a JSON token in errors.
+func describeToken(token json.Token) string {
+	switch token := token.(type) {
+	case json.Delim:
+		switch token {
+		case '{':
+			return "an object"
+		case '[':
+			return "an array"
+		}
+		return fmt.Sprintf("%q", token.String())
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	}
+	return "a number"
+}
@@ -0,0 +1,171 @@
+package nougat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// recordsServer responds to /records with the given status and body.
+func recordsServer(status int, body string) (*Nougat, func()) {
+	client, mux, server := testServer()
+	mux.HandleFunc("/records", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	})
+	return New().Client(client).Get("http://example.com/records"), server.Close
+}
+
+func TestReceiveNDJSON(t *testing.T) {
+	cases := []struct {
+		status        int
+		body          string
+		expected      []FakeModel
+		expectedError string
+	}{
+		{200, "{\"text\":\"a\",\"favorite_count\":1}\n{\"text\":\"b\"}\n\n{\"favorite_count\":3}\n", []FakeModel{{Text: "a", FavoriteCount: 1}, {Text: "b"}, {FavoriteCount: 3}}, ""},
+		// records don't need a trailing newline
+		{200, `{"text":"a"}` + "\r\n" + `{"text":"b"}`, []FakeModel{{Text: "a"}, {Text: "b"}}, ""},
+		{200, "", nil, ""},
+		{204, "", nil, ""},
+		{200, "{\"text\":\"a\"}\n{\"text\":", []FakeModel{{Text: "a"}}, "nougat: record 2: unexpected EOF"},
+		{200, "{\"text\":\"a\"}\n{\"text\":1}\n", []FakeModel{{Text: "a"}}, "nougat: record 2: json: cannot unmarshal number"},
+	}
+	for i, c := range cases {
+		n, closeServer := recordsServer(c.status, c.body)
+		records := ReceiveNDJSON[FakeModel](context.Background(), n)
+		var received []FakeModel
+		for records.Next() {
+			received = append(received, records.Item())
+		}
+		if !reflect.DeepEqual(c.expected, received) {
+			t.Errorf("%d: expected %v, got %v", i, c.expected, received)
+		}
+		if err := records.Err(); c.expectedError == "" && err != nil || c.expectedError != "" && (err == nil || !strings.HasPrefix(err.Error(), c.expectedError)) {
+			t.Errorf("%d: expected error %q, got %v", i, c.expectedError, err)
+		}
+		if records.Count() != len(c.expected) {
+			t.Errorf("%d: expected count %d, got %d", i, len(c.expected), records.Count())
+		}
+		closeServer()
+	}
+}
+
+func TestReceiveJSONArray(t *testing.T) {
+	cases := []struct {
+		body          string
+		path          string
+		expected      []FakeModel
+		expectedError string
+	}{
+		{`[{"text":"a"},{"text":"b","favorite_count":2}]`, "", []FakeModel{{Text: "a"}, {Text: "b", FavoriteCount: 2}}, ""},
+		// values before the array are skipped and after it aren't read
+		{`{"meta":{"count":[1,{"x":[]}]},"data":{"next":null,"items":[{"text":"a"}]},"trailer":`, "data.items", []FakeModel{{Text: "a"}}, ""},
+		{`{"data":{"items":[]}}`, "data.items", nil, ""},
+		{`{"data":{"items":null}}`, "data.items", nil, ""},
+		{`{"data":null}`, "data.items", nil, ""},
+		{`{"meta":{}}`, "data.items", nil, ""},
+		{``, "data", nil, ""},
+		{`{"data":{"items":{}}}`, "data.items", nil, `nougat: JSON array "data.items": expected an array, got an object`},
+		{`{"data":"items"}`, "data.items", nil, `nougat: JSON array "data.items": expected an object at "items", got a string`},
+		{`[{"text":"a"},{"text":"b"}`, "", []FakeModel{{Text: "a"}, {Text: "b"}}, "nougat: record 3: unexpected end of JSON input"},
+		{`[{"text":"a"},"b"]`, "", []FakeModel{{Text: "a"}}, "nougat: record 2: json: cannot unmarshal string"},
+	}
+	for i, c := range cases {
+		n, closeServer := recordsServer(200, c.body)
+		var received []FakeModel
+		err := ReceiveJSONArray[FakeModel](context.Background(), n, c.path).ForEach(func(item FakeModel) error {
+			received = append(received, item)
+			return nil
+		})
+		if !reflect.DeepEqual(c.expected, received) {
+			t.Errorf("%d: expected %v, got %v", i, c.expected, received)
+		}
+		if c.expectedError == "" && err != nil || c.expectedError != "" && (err == nil || !strings.HasPrefix(err.Error(), c.expectedError)) {
+			t.Errorf("%d: expected error %q, got %v", i, c.expectedError, err)
+		}
+		closeServer()
+	}
+}
+
+func TestRecords_failure(t *testing.T) {
+	n, closeServer := recordsServer(404, `{"message":"not found"}`)
+	defer closeServer()
+	records := ReceiveJSONArray[FakeModel](context.Background(), n, "")
+	if records.Next() {
+		t.Errorf("expected no records")
+	}
+	var httpErr *HTTPError
+	if err := records.Err(); !errors.As(err, &httpErr) || httpErr.StatusCode != 404 || string(httpErr.Body) != `{"message":"not found"}` {
+		t.Errorf("expected an *HTTPError, got %v", err)
+	}
+	if resp := records.Response(); resp == nil || resp.StatusCode != 404 {
+		t.Errorf("expected the 404 response, got %v", resp)
+	}
+}
+
+// countingBody counts the bytes read from a body and whether it was closed.
+type countingBody struct {
+	r      io.Reader
+	read   int
+	closed bool
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.read += n
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	b.closed = true
+	return nil
+}
+
+func TestRecords_streaming(t *testing.T) {
+	// a large array is decoded as it is read, and reading stops with the
+	// consumer
+	record := `{"text":"` + strings.Repeat("x", 1000) + `"},`
+	body := &countingBody{r: strings.NewReader("[" + strings.Repeat(record, 10000) + `{}]`)}
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: body, Request: req}, nil
+	})
+	stop := errors.New("stop")
+	err := ReceiveJSONArray[FakeModel](context.Background(), New().Doer(doer).Get("http://a.io/"), "").ForEach(func(item FakeModel) error {
+		if len(item.Text) != 1000 {
+			t.Errorf("expected a 1000 character text, got %d", len(item.Text))
+		}
+		return stop
+	})
+	if err != stop {
+		t.Errorf("expected %v, got %v", stop, err)
+	}
+	if body.read > 64<<10 {
+		t.Errorf("expected the body to be read as needed, read %d bytes", body.read)
+	}
+	if !body.closed {
+		t.Errorf("expected the body to be closed")
+	}
+}
+
+func TestRecords_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	n, closeServer := recordsServer(200, "{}\n{}\n{}\n")
+	defer closeServer()
+	records := ReceiveNDJSON[FakeModel](ctx, n)
+	if !records.Next() {
+		t.Fatalf("expected a record, got %v", records.Err())
+	}
+	cancel()
+	if records.Next() {
+		t.Errorf("expected no records after cancel")
+	}
+	if err := records.Err(); err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+}
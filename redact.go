@@ -0,0 +1,218 @@
+package nougat
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// redacted replaces secret values in URLs, headers and bodies.
+const redacted = "REDACTED"
+
+// sensitiveWords mark query parameter, header and field names whose values
+// are secrets, when contained in the normalized name.
+var sensitiveWords = []string{
+	"token",
+	"secret",
+	"password",
+	"passwd",
+	"apikey",
+	"signature",
+	"credential",
+	"cookie",
+}
+
+// sensitiveNameWords mark names whose values are secrets when they are one
+// of the words of the name. As substrings they would match other names,
+// such as "auth" in "Author".
+var sensitiveNameWords = map[string]bool{
+	"auth":           true,
+	"oauth":          true,
+	"authorization":  true,
+	"authentication": true,
+}
+
+// sensitiveNames are normalized names too short to match as words.
+var sensitiveNames = map[string]bool{
+	"key": true,
+	"sig": true,
+	"pwd": true,
+	"pin": true,
+}
+
+// normalizeName lower-cases name and removes '-' and '_'.
+func normalizeName(name string) string {
+	return strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(name))
+}
+
+// nameWords splits name into lower-cased words at characters other than
+// letters and digits, and at changes from lower to upper case, such as
+// "X-Auth-Token" and "XAuthToken" into "x", "auth" and "token".
+func nameWords(name string) []string {
+	var words []string
+	runes := []rune(name)
+	start := 0
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			if start < i {
+				words = append(words, strings.ToLower(string(runes[start:i])))
+			}
+			start = i + 1
+		case i > start && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) ||
+			i+1 < len(runes) && unicode.IsUpper(runes[i-1]) && unicode.IsLower(runes[i+1])):
+			words = append(words, strings.ToLower(string(runes[start:i])))
+			start = i
+		}
+	}
+	if start < len(runes) {
+		words = append(words, strings.ToLower(string(runes[start:])))
+	}
+	return words
+}
+
+// isSensitive reports whether name, compared case-insensitively and ignoring
+// '-' and '_', names a secret value, such as "access_token", "Authorization"
+// or "SecurityCredential", but not "Author".
+func isSensitive(name string) bool {
+	normalized := normalizeName(name)
+	if sensitiveNames[normalized] {
+		return true
+	}
+	for _, word := range sensitiveWords {
+		if strings.Contains(normalized, word) {
+			return true
+		}
+	}
+	for _, word := range nameWords(name) {
+		if sensitiveNameWords[word] {
+			return true
+		}
+	}
+	return false
+}
+
+// redactor redacts the values of sensitive names, and of additional names
+// compared like isSensitive.
+type redactor struct {
+	names map[string]bool
+}
+
+// newRedactor returns a redactor which also redacts the given names.
+func newRedactor(names ...[]string) redactor {
+	r := redactor{names: make(map[string]bool)}
+	for _, list := range names {
+		for _, name := range list {
+			r.names[normalizeName(name)] = true
+		}
+	}
+	return r
+}
+
+// sensitive reports whether the value of name should be redacted.
+func (r redactor) sensitive(name string) bool {
+	return r.names[normalizeName(name)] || isSensitive(name)
+}
+
+// header returns a copy of the header with sensitive values redacted.
+func (r redactor) header(header http.Header) http.Header {
+	clean := make(http.Header, len(header))
+	for key, values := range header {
+		if r.sensitive(key) {
+			values = []string{redacted}
+		}
+		clean[key] = append([]string(nil), values...)
+	}
+	return clean
+}
+
+// values redacts the sensitive values in place.
+func (r redactor) values(values url.Values) {
+	for key, vals := range values {
+		if r.sensitive(key) {
+			for i := range vals {
+				vals[i] = redacted
+			}
+		}
+	}
+}
+
+// url returns the URL as a string with its userinfo password and the
+// values of sensitive query parameters redacted.
+func (r redactor) url(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	clean := *u
+	if _, ok := clean.User.Password(); ok {
+		clean.User = url.UserPassword(clean.User.Username(), redacted)
+	}
+	if clean.RawQuery != "" {
+		values, err := url.ParseQuery(clean.RawQuery)
+		if err != nil {
+			clean.RawQuery = redacted
+		} else {
+			r.values(values)
+			clean.RawQuery = values.Encode()
+		}
+	}
+	return clean.String()
+}
+
+// body returns the body with the values of sensitive JSON object fields or
+// url encoded form fields redacted, according to the media type. Other
+// bodies are returned unchanged. ok is false for XML bodies and JSON or form
+// bodies which could not be parsed, which can't be redacted.
+func (r redactor) body(mediaType string, body []byte) (clean []byte, ok bool) {
+	mediaType = normalizeMediaType(mediaType)
+	switch {
+	case mediaType == jsonContentType || strings.HasSuffix(mediaType, "+json"):
+		var v interface{}
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&v); err != nil {
+			return nil, false
+		}
+		clean, err := json.Marshal(r.json(v))
+		return clean, err == nil
+	case mediaType == formContentType:
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, false
+		}
+		r.values(values)
+		return []byte(values.Encode()), true
+	case mediaType == "application/xml" || mediaType == "text/xml" || strings.HasSuffix(mediaType, "+xml"):
+		return nil, false
+	}
+	return body, true
+}
+
+// json redacts the values of sensitive object fields in the decoded JSON
+// value v, at any depth.
+func (r redactor) json(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			if r.sensitive(key) {
+				value[key] = redacted
+			} else {
+				value[key] = r.json(field)
+			}
+		}
+	case []interface{}:
+		for i, elem := range value {
+			value[i] = r.json(elem)
+		}
+	}
+	return v
+}
+
+// redactURL returns the URL as a string with its userinfo password and the
+// values of sensitive query parameters redacted.
+func redactURL(u *url.URL) string {
+	return redactor{}.url(u)
+}
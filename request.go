@@ -1,7 +1,9 @@
 package nougat
 
 import (
+	"context"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"net/url"
 )
@@ -9,13 +11,37 @@ import (
 // Requests
 
 // Request returns a new http.Request created with the Nougat properties.
-// Returns any errors parsing the rawURL, encoding query structs, encoding
-// the body, or creating the http.Request.
+// The request uses the context set with Context, or context.Background().
+// Returns the same errors as RequestContext.
 func (r *Nougat) Request() (*http.Request, error) {
-	reqURL, err := url.Parse(r.rawURL)
+	return r.RequestContext(r.context())
+}
+
+// RequestContext returns a new http.Request created with the Nougat
+// properties and the given context. The request's context records its
+// path template (see RouteTemplate). Encoding the body is skipped and the
+// context's error returned if the context is done.
+// Returns the first error recorded by a setter (see Err()), or any errors
+// expanding path parameters, parsing the rawURL, encoding query structs,
+// encoding the body, creating the http.Request, or fetching an access token.
+func (r *Nougat) RequestContext(ctx context.Context) (*http.Request, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	rawURL, err := r.expandPath(r.rawURL)
+	if err != nil {
+		return nil, err
+	}
+	reqURL, err := url.Parse(rawURL)
 	if err != nil {
 		return nil, err
 	}
+	if template, ok := r.routeTemplate(r.rawURL); ok {
+		ctx = context.WithValue(ctx, routeTemplateKey{}, template)
+	}
 
 	err = addQueryStructs(reqURL, r.queryStructs)
 	if err != nil {
@@ -23,16 +49,73 @@ func (r *Nougat) Request() (*http.Request, error) {
 	}
 
 	var body io.Reader
-	if r.bodyProvider != nil {
-		body, err = r.bodyProvider.Body()
+	provider := r.bodyProvider
+	if provider != nil && r.compression != "" {
+		provider = compressedBodyProvider{provider: provider, encoding: r.compression}
+	}
+	if provider != nil {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		body, err = provider.Body()
 		if err != nil {
 			return nil, err
 		}
+		if err = ctx.Err(); err != nil {
+			closeBody(body)
+			return nil, err
+		}
 	}
-	req, err := http.NewRequest(r.method, reqURL.String(), body)
+	req, err := http.NewRequestWithContext(ctx, r.method, reqURL.String(), body)
 	if err != nil {
+		closeBody(body)
 		return nil, err
 	}
+	if body != nil {
+		setGetBody(req, body, provider)
+	}
 	addHeaders(req, r.header)
+	if body != nil && r.compression != "" {
+		req.Header.Set(contentEncoding, string(r.compression))
+	}
+	if len(r.decoders) > 0 && req.Header.Get(accept) == "" {
+		req.Header.Set(accept, r.acceptHeader())
+	}
+	if r.tokenSource != nil {
+		if err = addToken(ctx, req, r.tokenSource); err != nil {
+			closeBody(body)
+			return nil, err
+		}
+	}
 	return req, err
 }
+
+// closeBody closes a request body which won't be sent, if it is an
+// io.Closer, so that streaming bodies stop encoding and files are closed.
+func closeBody(body io.Reader) {
+	if closer, ok := body.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// setGetBody sets the GetBody of req if the body provider is replayable, and
+// its ContentLength if the length of body is known.
+func setGetBody(req *http.Request, body io.Reader, provider BodyProvider) {
+	if req.ContentLength == 0 && req.Body != http.NoBody {
+		if lener, ok := body.(interface{ Len() int }); ok {
+			req.ContentLength = int64(lener.Len())
+		}
+	}
+	if replayable, ok := provider.(ReplayableBodyProvider); ok && replayable.Replayable() {
+		req.GetBody = func() (io.ReadCloser, error) {
+			body, err := provider.Body()
+			if err != nil {
+				return nil, err
+			}
+			if rc, ok := body.(io.ReadCloser); ok {
+				return rc, nil
+			}
+			return ioutil.NopCloser(body), nil
+		}
+	}
+}
@@ -2,8 +2,14 @@ package nougat
 
 import (
 	"bytes"
+	"encoding/xml"
 	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
 	"math"
+	"net/http"
+	"net/url"
 	"strings"
 	"testing"
 )
@@ -90,8 +96,9 @@ func TestRequest_body(t *testing.T) {
 		// Mixture of BodyJSON and BodyForm prefers body setter called last with a non-nil argument
 		{New().BodyForm(paramsB).New().BodyJSON(modelA), "{\"text\":\"note\",\"favorite_count\":12}\n", jsonContentType},
 		{New().BodyJSON(modelA).New().BodyForm(paramsB), "count=25&kind_name=recent", formContentType},
-		{New().BodyForm(paramsB).New().BodyJSON(nil), "count=25&kind_name=recent", formContentType},
-		{New().BodyJSON(modelA).New().BodyForm(nil), "{\"text\":\"note\",\"favorite_count\":12}\n", jsonContentType},
+		// BodyXML
+		{New().BodyXML(modelA), xml.Header + "<FakeModel><text>note</text><favorite_count>12</favorite_count><temperature>0</temperature></FakeModel>", xmlContentType},
+		{New().BodyJSON(modelA).New().BodyXML(&modelA), xml.Header + "<FakeModel><text>note</text><favorite_count>12</favorite_count><temperature>0</temperature></FakeModel>", xmlContentType},
 		// Body
 		{New().Body(strings.NewReader("this-is-a-test")), "this-is-a-test", ""},
 		{New().Body(strings.NewReader("a")).Body(strings.NewReader("b")), "b", ""},
@@ -115,8 +122,7 @@ func TestRequest_bodyNoData(t *testing.T) {
 	// test that Body is left nil when no bodyJSON or bodyStruct set
 	Nougats := []*Nougat{
 		New(),
-		New().BodyJSON(nil),
-		New().BodyForm(nil),
+		New().Get("http://a.io"),
 	}
 	for _, Nougat := range Nougats {
 		req, _ := Nougat.Request()
@@ -130,6 +136,51 @@ func TestRequest_bodyNoData(t *testing.T) {
 	}
 }
 
+func TestRequest_builderErrors(t *testing.T) {
+	cases := []struct {
+		Nougat      *Nougat
+		expectedErr string
+	}{
+		{New().Path("http://a.io/%zz"), `nougat: Path: parse "http://a.io/%zz": invalid URL escape "%zz"`},
+		{New().Base("http://a.io/").Post("%zz"), `nougat: Post: parse "%zz": invalid URL escape "%zz"`},
+		{New().Base("http://a.io/%zz").Get("foo"), `nougat: Base: parse "http://a.io/%zz": invalid URL escape "%zz"`},
+		{New().Body(nil), "nougat: Body: nil body"},
+		{New().BodyProvider(nil), "nougat: BodyProvider: nil body"},
+		{New().BodyForm(paramsB).New().BodyJSON(nil), "nougat: BodyJSON: nil body"},
+		{New().BodyJSON(modelA).New().BodyForm(nil), "nougat: BodyForm: nil body"},
+		{New().BodyXML(nil), "nougat: BodyXML: nil body"},
+		{New().BodySOAP(nil), "nougat: BodySOAP: nil body"},
+		{New().BodyMultipart(nil), "nougat: BodyMultipart: nil body"},
+		{New().PathStruct(42), "nougat: PathStruct: expected a struct, got int"},
+		// the first error is kept and inherited by children
+		{New().Body(nil).Get("%zz").New(), "nougat: Body: nil body"},
+	}
+	for _, c := range cases {
+		if err := c.Nougat.Err(); err == nil || err.Error() != c.expectedErr {
+			t.Errorf("expected Err %s, got %v", c.expectedErr, err)
+		}
+		req, err := c.Nougat.Request()
+		if err == nil || err.Error() != c.expectedErr {
+			t.Errorf("expected error %s, got %v", c.expectedErr, err)
+		}
+		if req != nil {
+			t.Errorf("expected nil Request, got %+v", req)
+		}
+		resp, err := c.Nougat.Receive(nil, nil)
+		if err != c.Nougat.Err() || resp != nil {
+			t.Errorf("expected Receive to return %v, got %v, %v", c.Nougat.Err(), resp, err)
+		}
+	}
+	if err := New().Get("http://a.io").Err(); err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	// errors wrap the underlying error
+	var urlErr *url.Error
+	if !errors.As(New().Path("%zz").Err(), &urlErr) {
+		t.Errorf("expected a *url.Error")
+	}
+}
+
 func TestRequest_bodyEncodeErrors(t *testing.T) {
 	cases := []struct {
 		Nougat      *Nougat
@@ -148,3 +199,143 @@ func TestRequest_bodyEncodeErrors(t *testing.T) {
 		}
 	}
 }
+
+// fakeBodyProvider provides a body through a reader which http.NewRequest
+// can't snapshot.
+type fakeBodyProvider struct {
+	content    string
+	replayable bool
+}
+
+func (p fakeBodyProvider) ContentType() string {
+	return "text/plain"
+}
+
+func (p fakeBodyProvider) Body() (io.Reader, error) {
+	return ioutil.NopCloser(strings.NewReader(p.content)), nil
+}
+
+func (p fakeBodyProvider) Replayable() bool {
+	return p.replayable
+}
+
+// closingBodyProvider provides a body which records whether it was closed.
+type closingBodyProvider struct {
+	body *countingBody
+}
+
+func (p closingBodyProvider) ContentType() string {
+	return "text/plain"
+}
+
+func (p closingBodyProvider) Body() (io.Reader, error) {
+	return p.body, nil
+}
+
+func (p closingBodyProvider) Replayable() bool {
+	return false
+}
+
+func TestRequest_errorClosesBody(t *testing.T) {
+	badMethod := New().Post("http://a.io/")
+	badMethod.method = "BAD METHOD"
+	cases := []*Nougat{
+		// the token can't be fetched
+		New().Post("http://a.io/").Auth(staticTokenSource{err: errDown}),
+		// the request can't be created
+		badMethod,
+	}
+	for i, n := range cases {
+		body := &countingBody{r: strings.NewReader("x")}
+		if _, err := n.BodyProvider(closingBodyProvider{body: body}).Request(); err == nil {
+			t.Errorf("%d: expected an error", i)
+		}
+		if !body.closed {
+			t.Errorf("%d: expected the body to be closed", i)
+		}
+	}
+}
+
+// lenReader is a reader which reports its length.
+type lenReader struct {
+	*strings.Reader
+}
+
+func TestRequest_getBody(t *testing.T) {
+	cases := []struct {
+		Nougat         *Nougat
+		expectedBody   string
+		expectedLength int64
+		replayable     bool
+	}{
+		{New().BodyJSON(modelA), "{\"text\":\"note\",\"favorite_count\":12}\n", 36, true},
+		{New().BodyForm(paramsB), "count=25&kind_name=recent", 25, true},
+		{New().BodyProvider(fakeBodyProvider{content: "replay me", replayable: true}), "replay me", 0, true},
+		{New().BodyMultipart(NewMultipart().Field("a", "b")), "", 0, true},
+		// lengths are taken from readers with a Len method
+		{New().Body(lenReader{strings.NewReader("sized")}), "", 5, false},
+	}
+	for _, c := range cases {
+		req, err := c.Nougat.Post("http://a.io").Request()
+		if err != nil {
+			t.Fatalf("expected nil, got %v", err)
+		}
+		if req.ContentLength != c.expectedLength {
+			t.Errorf("expected ContentLength %d, got %d", c.expectedLength, req.ContentLength)
+		}
+		if !c.replayable {
+			continue
+		}
+		if req.GetBody == nil {
+			t.Errorf("expected GetBody to be set for %T", c.Nougat.bodyProvider)
+			continue
+		}
+		first, _ := ioutil.ReadAll(req.Body)
+		for i := 0; i < 2; i++ {
+			body, err := req.GetBody()
+			if err != nil {
+				t.Fatalf("expected nil, got %v", err)
+			}
+			replayed, _ := ioutil.ReadAll(body)
+			if c.expectedBody != "" && string(replayed) != c.expectedBody || len(replayed) != len(first) {
+				t.Errorf("expected replayed body %q, got %q", first, replayed)
+			}
+		}
+	}
+}
+
+func TestRequest_notReplayable(t *testing.T) {
+	cases := []*Nougat{
+		New().BodyProvider(fakeBodyProvider{content: "once"}),
+		New().Body(&unbufferedReader{}),
+		New().BodyMultipart(NewMultipart().File("f", "f.txt", "", strings.NewReader("once"))),
+	}
+	for _, Nougat := range cases {
+		req, _ := Nougat.Post("http://a.io").Request()
+		if req.GetBody != nil {
+			t.Errorf("expected nil GetBody for %T", Nougat.bodyProvider)
+		}
+	}
+}
+
+func TestReceive_redirectReplaysBody(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/new", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, `{"text": %q}`, body)
+	})
+
+	model := new(FakeModel)
+	_, err := New().Client(client).Post("http://example.com/old").
+		BodyProvider(fakeBodyProvider{content: "replay me", replayable: true}).Receive(model, nil)
+	if err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if model.Text != "replay me" {
+		t.Errorf("expected %s, got %s", "replay me", model.Text)
+	}
+}
@@ -2,6 +2,7 @@ package nougat
 
 import (
 	"encoding/json"
+	"encoding/xml"
 	"net/http"
 )
 
@@ -14,10 +15,31 @@ type (
 	// jsonDecoder decodes http response JSON into a JSON-tagged struct value.
 	jsonDecoder struct {
 	}
+	// xmlDecoder decodes http response XML into an XML-tagged struct value.
+	xmlDecoder struct {
+	}
 )
 
+// JSONDecoder returns the default ResponseDecoder, which decodes JSON
+// response bodies into JSON-tagged struct values.
+func JSONDecoder() ResponseDecoder {
+	return jsonDecoder{}
+}
+
+// XMLDecoder returns a ResponseDecoder which decodes XML response bodies
+// into XML-tagged struct values.
+func XMLDecoder() ResponseDecoder {
+	return xmlDecoder{}
+}
+
 // Decode decodes the Response Body into the value pointed to by v.
 // Caller must provide a non-nil v and close the resp.Body.
 func (d jsonDecoder) Decode(resp *http.Response, v interface{}) error {
 	return json.NewDecoder(resp.Body).Decode(v)
 }
+
+// Decode decodes the Response Body into the value pointed to by v.
+// Caller must provide a non-nil v and close the resp.Body.
+func (d xmlDecoder) Decode(resp *http.Response, v interface{}) error {
+	return xml.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,280 @@
+package nougat
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryMinBackoff  = 100 * time.Millisecond
+	defaultRetryMaxBackoff  = 10 * time.Second
+	// defaultRetryMaxRetryAfter is the longest Retry-After wait honoured
+	// by default.
+	defaultRetryMaxRetryAfter = time.Minute
+	// maxRetryDrainBytes bounds how much of a retried response body is read
+	// so its connection can be reused.
+	maxRetryDrainBytes = 4 << 10
+)
+
+// defaultRetryStatusCodes are the response status codes retried when a
+// RetryPolicy doesn't list any.
+var defaultRetryStatusCodes = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryPolicy configures when and how often a Retrier retries requests.
+// Zero values are replaced by defaults.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts, including the first.
+	// Defaults to 3.
+	MaxAttempts int
+	// StatusCodes are the response status codes which are retried.
+	// Defaults to 429, 502, 503 and 504.
+	StatusCodes []int
+	// MinBackoff is the wait before the first retry. Each further retry
+	// doubles the wait, up to MaxBackoff. Defaults to 100ms.
+	MinBackoff time.Duration
+	// MaxBackoff caps the exponential backoff. Defaults to 10s.
+	MaxBackoff time.Duration
+	// MaxRetryAfter caps the wait asked for by a response's Retry-After
+	// header, which replaces the backoff. Responses asking for a longer
+	// wait aren't retried. Defaults to 1m.
+	MaxRetryAfter time.Duration
+	// RetryNonIdempotent retries requests whose methods aren't idempotent,
+	// such as POST and PATCH. By default they are only retried if they have
+	// an Idempotency-Key or X-Idempotency-Key header.
+	RetryNonIdempotent bool
+	// OnRetry, if set, is called before waiting for each retry.
+	OnRetry func(attempt RetryAttempt)
+}
+
+// RetryAttempt describes a failed attempt which is about to be retried.
+type RetryAttempt struct {
+	// Request is the request which was sent.
+	Request *http.Request
+	// Attempt is the number of the failed attempt, starting at 1.
+	Attempt int
+	// Response is the retryable response, or nil if Err is set. Its Body has
+	// already been closed.
+	Response *http.Response
+	// Err is the error returned by the wrapped Doer, if any.
+	Err error
+	// Wait is how long the Retrier waits before the next attempt.
+	Wait time.Duration
+}
+
+// Retrier is a Doer which retries requests that fail with a transient
+// network error, such as a timeout or a refused or reset connection, or
+// with a retryable status code. Waits between attempts grow exponentially with
+// jitter, or follow the response's Retry-After header when present.
+//
+// Only requests with idempotent methods (GET, HEAD, OPTIONS, TRACE, PUT and
+// DELETE) are retried, unless the policy's RetryNonIdempotent is set.
+// Requests with a body are only retried if they can be rewound with
+// http.Request.GetBody, which Request sets for replayable body providers
+// (see ReplayableBodyProvider).
+type Retrier struct {
+	doer   Doer
+	policy RetryPolicy
+	// sleep waits for d or until ctx is done
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewRetrier returns a Retrier which sends requests with the given Doer.
+// If a nil doer is given, the http.DefaultClient will be used.
+func NewRetrier(doer Doer, policy RetryPolicy) *Retrier {
+	if doer == nil {
+		doer = http.DefaultClient
+	}
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if len(policy.StatusCodes) == 0 {
+		policy.StatusCodes = defaultRetryStatusCodes
+	}
+	if policy.MinBackoff <= 0 {
+		policy.MinBackoff = defaultRetryMinBackoff
+	}
+	if policy.MaxBackoff <= 0 {
+		policy.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if policy.MaxBackoff < policy.MinBackoff {
+		policy.MaxBackoff = policy.MinBackoff
+	}
+	if policy.MaxRetryAfter <= 0 {
+		policy.MaxRetryAfter = defaultRetryMaxRetryAfter
+	}
+	return &Retrier{doer: doer, policy: policy, sleep: sleepContext}
+}
+
+// Do sends the request, retrying it according to the Retrier's policy.
+// The last response or error is returned once attempts are exhausted.
+func (rt *Retrier) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	rewindable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	retryable := rewindable && (rt.policy.RetryNonIdempotent || idempotent(req))
+
+	attemptReq := req
+	for attempt := 1; ; attempt++ {
+		resp, err := rt.doer.Do(attemptReq)
+		if attempt >= rt.policy.MaxAttempts || !retryable || ctx.Err() != nil || !rt.retryable(resp, err) {
+			return resp, err
+		}
+
+		wait := rt.backoff(attempt)
+		if resp != nil {
+			if d, ok := retryAfter(resp, time.Now()); ok {
+				if d > rt.policy.MaxRetryAfter {
+					// the server asks for a longer wait than allowed
+					return resp, err
+				}
+				wait = d
+			}
+			io.CopyN(ioutil.Discard, resp.Body, maxRetryDrainBytes)
+			resp.Body.Close()
+		}
+		if rt.policy.OnRetry != nil {
+			rt.policy.OnRetry(RetryAttempt{Request: attemptReq, Attempt: attempt, Response: resp, Err: err, Wait: wait})
+		}
+		if err := rt.sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+
+		attemptReq, err = rewindRequest(req)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// retryable reports whether the given result of an attempt should be retried.
+func (rt *Retrier) retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return transientError(err)
+	}
+	for _, code := range rt.policy.StatusCodes {
+		if resp.StatusCode == code {
+			return true
+		}
+	}
+	return false
+}
+
+// transientError reports whether a transport error may not recur when the
+// request is sent again: timeouts, refused or reset connections and
+// connections closed early. Errors such as an unsupported URL scheme, an
+// unknown host or a failed certificate verification are permanent.
+func transientError(err error) bool {
+	var verificationErr *tls.CertificateVerificationError
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	var hostnameErr x509.HostnameError
+	if errors.As(err, &verificationErr) || errors.As(err, &unknownAuthorityErr) ||
+		errors.As(err, &invalidErr) || errors.As(err, &hostnameErr) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTimeout || dnsErr.IsTemporary
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	// other errors of established connections, such as broken pipes
+	var opErr *net.OpError
+	return errors.As(err, &opErr)
+}
+
+// idempotent reports whether the request may be sent more than once: its
+// method is idempotent or it has an idempotency key.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+// backoff returns the wait after the given failed attempt: an exponentially
+// growing duration, capped at MaxBackoff, with up to half of it randomized.
+func (rt *Retrier) backoff(attempt int) time.Duration {
+	d := rt.policy.MinBackoff
+	for i := 1; i < attempt && d < rt.policy.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > rt.policy.MaxBackoff {
+		d = rt.policy.MaxBackoff
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// rewindRequest returns a copy of req with a fresh Body from GetBody.
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	clone := req.Clone(req.Context())
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		clone.Body = body
+	}
+	return clone, nil
+}
+
+// retryAfter parses the response's Retry-After header, given either as
+// delay-seconds or as an HTTP-date, into a wait duration.
+func retryAfter(resp *http.Response, now time.Time) (time.Duration, bool) {
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if d := date.Sub(now); d > 0 {
+			return d, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// sleepContext waits for the duration d or until ctx is done, in which case
+// the context's error is returned.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
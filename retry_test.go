@@ -0,0 +1,344 @@
+package nougat
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// errConnReset is the error of a connection reset by the server.
+var errConnReset = &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+
+func TestRetrier_retriesStatusCodes(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	var calls int
+	mux.HandleFunc("/submit", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		if string(body) != "{\"text\":\"note\",\"favorite_count\":12}\n" {
+			t.Errorf("attempt %d: unexpected body %q", calls, body)
+		}
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"text": "Some text"}`)
+	})
+
+	var attempts []RetryAttempt
+	retrier := NewRetrier(client, RetryPolicy{
+		MinBackoff:         time.Millisecond,
+		RetryNonIdempotent: true,
+		OnRetry: func(attempt RetryAttempt) {
+			attempts = append(attempts, attempt)
+		},
+	})
+
+	model := new(FakeModel)
+	resp, err := New().Doer(retrier).Post("http://example.com/submit").BodyJSON(modelA).Receive(model, nil)
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("expected %d, got %d", 200, resp.StatusCode)
+	}
+	if model.Text != "Some text" {
+		t.Errorf("expected %s, got %s", "Some text", model.Text)
+	}
+	if calls != 3 {
+		t.Errorf("expected %d calls, got %d", 3, calls)
+	}
+	if len(attempts) != 2 {
+		t.Fatalf("expected %d retries, got %d", 2, len(attempts))
+	}
+	for i, attempt := range attempts {
+		if attempt.Attempt != i+1 {
+			t.Errorf("expected attempt %d, got %d", i+1, attempt.Attempt)
+		}
+		if attempt.Response == nil || attempt.Response.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("expected %d response, got %v", http.StatusServiceUnavailable, attempt.Response)
+		}
+	}
+}
+
+func TestRetrier_maxAttempts(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	var calls int
+	mux.HandleFunc("/limited", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+
+	retrier := NewRetrier(client, RetryPolicy{MaxAttempts: 2, MinBackoff: time.Millisecond})
+	resp, err := New().Doer(retrier).Get("http://example.com/limited").Receive(nil, nil)
+	if err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected %d, got %d", http.StatusTooManyRequests, resp.StatusCode)
+	}
+	if calls != 2 {
+		t.Errorf("expected %d calls, got %d", 2, calls)
+	}
+}
+
+func TestRetrier_doesNotRetryOtherStatusCodes(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	var calls int
+	mux.HandleFunc("/failure", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	retrier := NewRetrier(client, RetryPolicy{MinBackoff: time.Millisecond})
+	resp, _ := New().Doer(retrier).Get("http://example.com/failure").Receive(nil, nil)
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected %d, got %d", http.StatusInternalServerError, resp.StatusCode)
+	}
+	if calls != 1 {
+		t.Errorf("expected %d calls, got %d", 1, calls)
+	}
+}
+
+func TestRetrier_connectionErrors(t *testing.T) {
+	var calls int
+	expectedErr := error(&net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED})
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		return nil, expectedErr
+	})
+
+	retrier := NewRetrier(doer, RetryPolicy{MaxAttempts: 4, MinBackoff: time.Millisecond})
+	_, err := New().Doer(retrier).Get("http://example.com/").Receive(nil, nil)
+	if err != expectedErr {
+		t.Errorf("expected %v, got %v", expectedErr, err)
+	}
+	if calls != 4 {
+		t.Errorf("expected %d calls, got %d", 4, calls)
+	}
+}
+
+func TestRetrier_transientErrors(t *testing.T) {
+	cases := []struct {
+		err           error
+		expectedCalls int
+	}{
+		{errConnReset, 3},
+		{&url.Error{Op: "Get", URL: "http://example.com/", Err: io.ErrUnexpectedEOF}, 3},
+		{&url.Error{Op: "Get", URL: "http://example.com/", Err: &net.DNSError{Err: "timeout", IsTimeout: true}}, 3},
+		// permanent errors aren't retried
+		{&url.Error{Op: "Get", URL: "ftp://example.com/", Err: errors.New("unsupported protocol scheme \"ftp\"")}, 1},
+		{&url.Error{Op: "Get", URL: "https://example.com/", Err: &tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}}, 1},
+		{&url.Error{Op: "Get", URL: "http://example.com/", Err: &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}}, 1},
+	}
+	for _, c := range cases {
+		var calls int
+		doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+			calls++
+			return nil, c.err
+		})
+		NewRetrier(doer, RetryPolicy{MinBackoff: time.Millisecond}).Do(httpRequest(t, "GET", "http://example.com/"))
+		if calls != c.expectedCalls {
+			t.Errorf("%v: expected %d calls, got %d", c.err, c.expectedCalls, calls)
+		}
+	}
+}
+
+func TestRetrier_unrewindableBody(t *testing.T) {
+	var calls int
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		return nil, errConnReset
+	})
+
+	req, _ := http.NewRequest("POST", "http://example.com/", ioutil.NopCloser(&unbufferedReader{}))
+	NewRetrier(doer, RetryPolicy{MinBackoff: time.Millisecond, RetryNonIdempotent: true}).Do(req)
+	if calls != 1 {
+		t.Errorf("expected %d calls, got %d", 1, calls)
+	}
+}
+
+func TestRetrier_nonIdempotentMethods(t *testing.T) {
+	cases := []struct {
+		method        string
+		header        http.Header
+		policy        RetryPolicy
+		expectedCalls int
+	}{
+		{"GET", nil, RetryPolicy{}, 3},
+		{"PUT", nil, RetryPolicy{}, 3},
+		{"DELETE", nil, RetryPolicy{}, 3},
+		{"POST", nil, RetryPolicy{}, 1},
+		{"PATCH", nil, RetryPolicy{}, 1},
+		{"POST", http.Header{"Idempotency-Key": {"k"}}, RetryPolicy{}, 3},
+		{"PATCH", nil, RetryPolicy{RetryNonIdempotent: true}, 3},
+	}
+	for _, c := range cases {
+		var calls int
+		doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+			calls++
+			return nil, errConnReset
+		})
+		c.policy.MinBackoff = time.Millisecond
+		req := httpRequest(t, c.method, "http://example.com/")
+		req.Header = c.header
+		NewRetrier(doer, c.policy).Do(req)
+		if calls != c.expectedCalls {
+			t.Errorf("%s %v: expected %d calls, got %d", c.method, c.header, c.expectedCalls, calls)
+		}
+	}
+}
+
+func TestRetrier_retryAfter(t *testing.T) {
+	var calls int
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		resp := &http.Response{StatusCode: 200, Header: http.Header{}, Body: http.NoBody}
+		if calls == 1 {
+			resp.StatusCode = http.StatusTooManyRequests
+			resp.Header.Set("Retry-After", "7")
+		}
+		return resp, nil
+	})
+
+	var waits []time.Duration
+	retrier := NewRetrier(doer, RetryPolicy{})
+	retrier.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	resp, err := retrier.Do(httpRequest(t, "GET", "http://example.com/"))
+	if err != nil || resp.StatusCode != 200 {
+		t.Errorf("expected 200 response, got %v, %v", resp, err)
+	}
+	if len(waits) != 1 || waits[0] != 7*time.Second {
+		t.Errorf("expected a 7s wait, got %v", waits)
+	}
+
+	// Retry-After isn't capped by MaxBackoff
+	calls, waits = 0, nil
+	retrier = NewRetrier(doer, RetryPolicy{MaxBackoff: 5 * time.Second})
+	retrier.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	resp, err = retrier.Do(httpRequest(t, "GET", "http://example.com/"))
+	if err != nil || resp.StatusCode != 200 || len(waits) != 1 || waits[0] != 7*time.Second {
+		t.Errorf("expected 200 response after a 7s wait, got %v, %v and waits %v", resp, err, waits)
+	}
+
+	// waits longer than MaxRetryAfter aren't retried
+	calls, waits = 0, nil
+	retrier = NewRetrier(doer, RetryPolicy{MaxRetryAfter: 5 * time.Second})
+	retrier.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	resp, err = retrier.Do(httpRequest(t, "GET", "http://example.com/"))
+	if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+		t.Errorf("expected 429 response, got %v, %v", resp, err)
+	}
+	if calls != 1 || len(waits) != 0 {
+		t.Errorf("expected no retries, got %d calls and waits %v", calls, waits)
+	}
+}
+
+func TestRetrier_contextCanceledWhileWaiting(t *testing.T) {
+	doer := DoerFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusBadGateway, Header: http.Header{}, Body: http.NoBody}, nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	retrier := NewRetrier(doer, RetryPolicy{
+		MinBackoff: time.Hour,
+		OnRetry: func(attempt RetryAttempt) {
+			cancel()
+		},
+	})
+	req, _ := http.NewRequestWithContext(ctx, "GET", "http://example.com/", nil)
+	resp, err := retrier.Do(req)
+	if err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if resp != nil {
+		t.Errorf("expected nil resp, got %v", resp)
+	}
+}
+
+func TestRetrier_backoff(t *testing.T) {
+	retrier := NewRetrier(nil, RetryPolicy{MinBackoff: 100 * time.Millisecond, MaxBackoff: time.Second})
+	cases := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{10, time.Second},
+	}
+	for _, c := range cases {
+		for i := 0; i < 20; i++ {
+			d := retrier.backoff(c.attempt)
+			if d < c.max/2 || d > c.max {
+				t.Errorf("attempt %d: expected backoff in [%v, %v], got %v", c.attempt, c.max/2, c.max, d)
+			}
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{"Wed, 01 Jan 2020 00:00:30 GMT", 30 * time.Second, true},
+		{"Tue, 31 Dec 2019 23:59:00 GMT", 0, true},
+	}
+	for _, c := range cases {
+		resp := &http.Response{Header: http.Header{}}
+		if c.value != "" {
+			resp.Header.Set("Retry-After", c.value)
+		}
+		d, ok := retryAfter(resp, now)
+		if d != c.expected || ok != c.ok {
+			t.Errorf("%q: expected (%v, %t), got (%v, %t)", c.value, c.expected, c.ok, d, ok)
+		}
+	}
+}
+
+// unbufferedReader is an io.Reader which http.NewRequest cannot snapshot.
+type unbufferedReader struct{}
+
+func (r *unbufferedReader) Read(p []byte) (int, error) {
+	return 0, errors.New("unbufferedReader: not readable")
+}
+
+func httpRequest(t *testing.T, method, url string) *http.Request {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
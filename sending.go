@@ -25,7 +25,7 @@ func (r *Nougat) ResponseDecoder(decoder ResponseDecoder) *Nougat {
 // decoding is skipped.
 // Caller is responsible for closing the resp.Body.
 func decodeResponse(resp *http.Response, decoder ResponseDecoder, successV, failureV interface{}) error {
-	if code := resp.StatusCode; 200 <= code && code <= 299 {
+	if isSuccess(resp.StatusCode) {
 		if successV != nil {
 			return decoder.Decode(resp, successV)
 		}
@@ -36,3 +36,8 @@ func decodeResponse(resp *http.Response, decoder ResponseDecoder, successV, fail
 	}
 	return nil
 }
+
+// isSuccess reports whether the status code is a success (2XX).
+func isSuccess(code int) bool {
+	return 200 <= code && code <= 299
+}
@@ -0,0 +1,185 @@
+package nougat
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+const (
+	soapContentType = "text/xml; charset=utf-8"
+	soapEnvelopeNS  = "http://schemas.xmlsoap.org/soap/envelope/"
+)
+
+type (
+	// soapBodyProvider encodes an XML tagged struct value inside a SOAP 1.1
+	// envelope as a Body for requests.
+	soapBodyProvider struct {
+		payload interface{}
+	}
+
+	// soapDecoder decodes the content of the Body of a SOAP envelope into an
+	// XML-tagged struct value.
+	soapDecoder struct {
+	}
+
+	// SOAPFault is a SOAP 1.1 or 1.2 fault returned in place of a SOAP
+	// response body.
+	SOAPFault struct {
+		// Code is the faultcode, or the Code Value of a SOAP 1.2 fault.
+		Code string
+		// String is the faultstring, or the Reason Text of a SOAP 1.2 fault.
+		String string
+		// Actor is the faultactor, or the Role of a SOAP 1.2 fault.
+		Actor string
+		// Detail is the raw XML content of the fault detail.
+		Detail string
+	}
+
+	// soapFault maps both SOAP 1.1 and 1.2 fault elements.
+	soapFault struct {
+		Code     string       `xml:"faultcode"`
+		String   string       `xml:"faultstring"`
+		Actor    string       `xml:"faultactor"`
+		Detail   soapInnerXML `xml:"detail"`
+		Code12   string       `xml:"Code>Value"`
+		Reason   string       `xml:"Reason>Text"`
+		Role     string       `xml:"Role"`
+		Detail12 soapInnerXML `xml:"Detail"`
+	}
+
+	soapInnerXML struct {
+		Content string `xml:",innerxml"`
+	}
+)
+
+func (f *SOAPFault) Error() string {
+	return fmt.Sprintf("soap fault: %s: %s", f.Code, f.String)
+}
+
+/********************************** SOAP BODY *********************************************/
+
+func (p soapBodyProvider) ContentType() string {
+	return soapContentType
+}
+
+func (p soapBodyProvider) Replayable() bool {
+	return true
+}
+
+func (p soapBodyProvider) Body() (io.Reader, error) {
+	buf := bytes.NewBufferString(xml.Header)
+	buf.WriteString(`<soap:Envelope xmlns:soap="` + soapEnvelopeNS + `"><soap:Body>`)
+
+	err := xml.NewEncoder(buf).Encode(p.payload)
+	if err != nil {
+		return nil, err
+	}
+	buf.WriteString(`</soap:Body></soap:Envelope>`)
+	return buf, nil
+}
+
+// BodySOAP sets the Nougat's bodySOAP.
+// The value pointed to by the bodySOAP will be XML encoded and wrapped in a
+// SOAP 1.1 envelope as the Body on new requests (see Request()). Set the
+// SOAPAction header, if the service requires one, with Set.
+// The bodySOAP argument should be a pointer to an XML tagged struct.
+// A nil bodySOAP leaves the body unchanged and records an error (see Err()).
+func (r *Nougat) BodySOAP(bodySOAP interface{}) *Nougat {
+	if bodySOAP == nil {
+		r.setErr("BodySOAP", errNilBody)
+		return r
+	}
+	return r.BodyProvider(soapBodyProvider{payload: bodySOAP})
+}
+
+/********************************** SOAP DECODER *********************************************/
+
+// SOAPDecoder returns a ResponseDecoder which unwraps SOAP envelopes and
+// decodes the content of their Body into XML-tagged struct values.
+// SOAP faults are returned as a *SOAPFault error, unless the value decoded
+// into is itself a *SOAPFault.
+func SOAPDecoder() ResponseDecoder {
+	return soapDecoder{}
+}
+
+// Decode decodes the SOAP Body of the Response Body into the value pointed
+// to by v.
+// Caller must provide a non-nil v and close the resp.Body.
+func (d soapDecoder) Decode(resp *http.Response, v interface{}) error {
+	dec := xml.NewDecoder(resp.Body)
+	inEnvelope, inBody := false, false
+	for {
+		token, err := dec.Token()
+		if err == io.EOF {
+			if !inEnvelope {
+				return errors.New("nougat: response is not a SOAP envelope")
+			}
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch {
+			case !inEnvelope:
+				if t.Name.Local != "Envelope" {
+					return errors.New("nougat: response is not a SOAP envelope")
+				}
+				inEnvelope = true
+			case !inBody:
+				if t.Name.Local == "Body" {
+					inBody = true
+				} else if err := dec.Skip(); err != nil {
+					// skip the Header and other elements
+					return err
+				}
+			case t.Name.Local == "Fault":
+				return decodeSOAPFault(dec, t, v)
+			default:
+				return dec.DecodeElement(v, &t)
+			}
+		case xml.EndElement:
+			if inBody {
+				// empty SOAP Body
+				return nil
+			}
+			// the end of the envelope, as other elements were skipped
+			return errors.New("nougat: SOAP envelope has no Body")
+		}
+	}
+}
+
+// decodeSOAPFault decodes the fault element start into v if v is a
+// *SOAPFault, or returns the fault as an error.
+func decodeSOAPFault(dec *xml.Decoder, start xml.StartElement, v interface{}) error {
+	var raw soapFault
+	if err := dec.DecodeElement(&raw, &start); err != nil {
+		return err
+	}
+	fault := &SOAPFault{
+		Code:   firstNonEmpty(raw.Code, raw.Code12),
+		String: firstNonEmpty(raw.String, raw.Reason),
+		Actor:  firstNonEmpty(raw.Actor, raw.Role),
+		Detail: strings.TrimSpace(firstNonEmpty(raw.Detail.Content, raw.Detail12.Content)),
+	}
+	if target, ok := v.(*SOAPFault); ok {
+		*target = *fault
+		return nil
+	}
+	return fault
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
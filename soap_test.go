@@ -0,0 +1,127 @@
+package nougat
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type fakeBalanceRequest struct {
+	XMLName xml.Name `xml:"urn:bank GetBalance"`
+	Account string   `xml:"Account"`
+}
+
+type fakeBalanceResponse struct {
+	XMLName xml.Name `xml:"GetBalanceResponse"`
+	Balance float64  `xml:"Balance"`
+}
+
+func TestRequest_bodySOAP(t *testing.T) {
+	req, err := New().Post("http://a.io/soap").BodySOAP(&fakeBalanceRequest{Account: "001"}).Request()
+	if err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+	body, _ := ioutil.ReadAll(req.Body)
+	expected := xml.Header + `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<GetBalance xmlns="urn:bank"><Account>001</Account></GetBalance></soap:Body></soap:Envelope>`
+	if string(body) != expected {
+		t.Errorf("expected %s, got %s", expected, body)
+	}
+	if value := req.Header.Get(contentType); value != soapContentType {
+		t.Errorf("expected %s, got %s", soapContentType, value)
+	}
+}
+
+func TestSOAPDecoder(t *testing.T) {
+	cases := []struct {
+		body     string
+		expected fakeBalanceResponse
+		err      string
+	}{
+		{
+			`<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">
+				<s:Header><Session>abc</Session></s:Header>
+				<s:Body><GetBalanceResponse><Balance>10.5</Balance></GetBalanceResponse></s:Body>
+			</s:Envelope>`,
+			fakeBalanceResponse{XMLName: xml.Name{Local: "GetBalanceResponse"}, Balance: 10.5}, "",
+		},
+		// empty SOAP Body
+		{`<Envelope><Body></Body></Envelope>`, fakeBalanceResponse{}, ""},
+		// SOAP 1.1 fault
+		{
+			`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><s:Fault>
+				<faultcode>s:Client</faultcode><faultstring>Invalid account</faultstring>
+			</s:Fault></s:Body></s:Envelope>`,
+			fakeBalanceResponse{}, "soap fault: s:Client: Invalid account",
+		},
+		// SOAP 1.2 fault
+		{
+			`<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body><env:Fault>
+				<env:Code><env:Value>env:Sender</env:Value></env:Code>
+				<env:Reason><env:Text xml:lang="en">Invalid account</env:Text></env:Reason>
+			</env:Fault></env:Body></env:Envelope>`,
+			fakeBalanceResponse{}, "soap fault: env:Sender: Invalid account",
+		},
+		{`<GetBalanceResponse><Balance>10.5</Balance></GetBalanceResponse>`, fakeBalanceResponse{}, "nougat: response is not a SOAP envelope"},
+		{`<Envelope><Header><Session>abc</Session></Header></Envelope>`, fakeBalanceResponse{}, "nougat: SOAP envelope has no Body"},
+		{`<Envelope/>`, fakeBalanceResponse{}, "nougat: SOAP envelope has no Body"},
+		{`<Envelope><Body>`, fakeBalanceResponse{}, "XML syntax error on line 1: unexpected EOF"},
+	}
+	for _, c := range cases {
+		resp := &http.Response{Body: ioutil.NopCloser(strings.NewReader(c.body))}
+		var value fakeBalanceResponse
+		err := SOAPDecoder().Decode(resp, &value)
+		if c.err == "" && err != nil {
+			t.Errorf("expected nil, got %v", err)
+		} else if c.err != "" && (err == nil || err.Error() != c.err) {
+			t.Errorf("expected error %s, got %v", c.err, err)
+		}
+		if !reflect.DeepEqual(c.expected, value) {
+			t.Errorf("expected %v, got %v", c.expected, value)
+		}
+	}
+}
+
+func TestReceive_soapFault(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/soap", func(w http.ResponseWriter, r *http.Request) {
+		if value := r.Header.Get("SOAPAction"); value != "urn:bank/GetBalance" {
+			t.Errorf("expected SOAPAction header, got %s", value)
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(500)
+		fmt.Fprintf(w, `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body><s:Fault>`+
+			`<faultcode>s:Server</faultcode><faultstring>Unavailable</faultstring><detail><Code>42</Code></detail>`+
+			`</s:Fault></s:Body></s:Envelope>`)
+	})
+
+	endpoint := New().Client(client).Post("http://example.com/soap").Set("SOAPAction", "urn:bank/GetBalance").
+		BodySOAP(&fakeBalanceRequest{Account: "001"}).ResponseDecoder(SOAPDecoder())
+
+	// a *SOAPFault failureV is populated
+	fault := new(SOAPFault)
+	resp, err := endpoint.New().Receive(new(fakeBalanceResponse), fault)
+	if err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if resp.StatusCode != 500 {
+		t.Errorf("expected %d, got %d", 500, resp.StatusCode)
+	}
+	expected := &SOAPFault{Code: "s:Server", String: "Unavailable", Detail: "<Code>42</Code>"}
+	if !reflect.DeepEqual(expected, fault) {
+		t.Errorf("expected %v, got %v", expected, fault)
+	}
+
+	// otherwise the fault is returned as an error
+	_, err = endpoint.New().Receive(new(fakeBalanceResponse), new(fakeBalanceResponse))
+	var faultErr *SOAPFault
+	if !errors.As(err, &faultErr) || faultErr.String != "Unavailable" {
+		t.Errorf("expected a *SOAPFault error, got %v", err)
+	}
+}
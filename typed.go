@@ -0,0 +1,104 @@
+package nougat
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// ReceiveAs creates a new HTTP request with the Nougat properties and
+// returns the decoded success response as a value of type T.
+// Non-2XX responses are decoded into a value of type E and returned as an
+// *HTTPError whose Failure is the *E. If the status code of response is
+// 204(no content), decoding is skipped and the zero T is returned.
+// Any error creating the request, sending it, or decoding the response is
+// returned. For example,
+//
+//	user, resp, err := nougat.ReceiveAs[User, APIError](api.New().Get("users/42"))
+func ReceiveAs[T, E any](n *Nougat) (T, *http.Response, error) {
+	return ReceiveAsContext[T, E](n.context(), n)
+}
+
+// ReceiveAsContext is like ReceiveAs, but creates the request with the
+// given context.
+func ReceiveAsContext[T, E any](ctx context.Context, n *Nougat) (T, *http.Response, error) {
+	var success T
+	req, err := n.RequestContext(ctx)
+	if err != nil {
+		return success, nil, err
+	}
+	resp, err := n.do(req, &success, new(E), true)
+	return success, resp, err
+}
+
+// Endpoint is a typed API endpoint, bundling the method and path of the
+// endpoint with the types of its request and response values. For example,
+//
+//	var createUser = nougat.Endpoint[CreateUser, User]{Method: "POST", Path: "users"}
+//
+//	user, resp, err := createUser.Call(ctx, api, CreateUser{Name: "Wanjiru"})
+//
+// Non-2XX responses are returned as an *HTTPError. Unlike ReceiveAs, Call
+// doesn't decode failure bodies, so the HTTPError's Failure is nil and its
+// Body holds the start of the response body.
+type Endpoint[Req, Resp any] struct {
+	// Method is the HTTP method, case insensitively. Defaults to "GET".
+	Method string
+	// Path is resolved against the base URL of the Nougat the endpoint is
+	// called with (see Path()). Placeholders in the path, such as "{id}" in
+	// "users/{id}", take their values from the fields of a struct request
+	// value (see PathStruct()).
+	Path string
+	// Encode sets the request value on the Nougat, such as
+	// (*Nougat).BodyForm. By default, values of GET and HEAD requests are
+	// encoded as url query parameters (see QueryStruct()), except fields
+	// bound to path placeholders, and other values as a JSON body (see
+	// BodyJSON()).
+	Encode func(n *Nougat, v interface{}) *Nougat
+}
+
+// Call sends the request value to the endpoint using a child of the given
+// Nougat and returns the decoded response value.
+func (e Endpoint[Req, Resp]) Call(ctx context.Context, n *Nougat, req Req) (Resp, *http.Response, error) {
+	var success Resp
+	method := strings.ToUpper(e.Method)
+	if method == "" {
+		method = "GET"
+	}
+	child := n.New()
+	child.method = method
+	child.Path(e.Path)
+
+	encode := e.Encode
+	if encode == nil {
+		if method == "GET" || method == "HEAD" {
+			encode = func(n *Nougat, v interface{}) *Nougat {
+				return n.queryWithoutPathFields(v, e.Path)
+			}
+		} else {
+			encode = (*Nougat).BodyJSON
+		}
+	}
+	// nil pointers have no value to encode, rather than a JSON null body
+	if v := interface{}(req); v != nil && !isNilPointer(v) {
+		// only structs have fields for path placeholders
+		if kind := reflect.Indirect(reflect.ValueOf(v)).Kind(); kind == reflect.Struct {
+			child.PathStruct(v)
+		}
+		encode(child, v)
+	}
+
+	httpReq, err := child.RequestContext(ctx)
+	if err != nil {
+		return success, nil, err
+	}
+	resp, err := child.do(httpReq, &success, nil, true)
+	return success, resp, err
+}
+
+// isNilPointer reports whether v is a nil pointer of some type.
+func isNilPointer(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
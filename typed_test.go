@@ -0,0 +1,239 @@
+package nougat
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReceiveAs_success(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/foo", func(w http.ResponseWriter, r *http.Request) {
+		assertQuery(t, map[string]string{"kind_name": "vanilla", "count": "11"}, r)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"text": "Some text", "favorite_count": 24}`)
+	})
+
+	params := FakeParams{KindName: "vanilla", Count: 11}
+	model, resp, err := ReceiveAs[FakeModel, APIError](New().Client(client).Get("http://example.com/foo").QueryStruct(params))
+	if err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("expected %d, got %d", 200, resp.StatusCode)
+	}
+	expected := FakeModel{Text: "Some text", FavoriteCount: 24}
+	if model != expected {
+		t.Errorf("expected %v, got %v", expected, model)
+	}
+}
+
+func TestReceiveAs_failure(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/foo", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(429)
+		fmt.Fprintf(w, `{"message": "Rate limit exceeded", "code": 88}`)
+	})
+
+	model, resp, err := ReceiveAs[FakeModel, APIError](New().Client(client).Get("http://example.com/foo"))
+	if resp.StatusCode != 429 {
+		t.Errorf("expected %d, got %d", 429, resp.StatusCode)
+	}
+	var apiError *APIError
+	if !errors.As(err, &apiError) {
+		t.Fatalf("expected an *APIError, got %v", err)
+	}
+	expected := &APIError{Message: "Rate limit exceeded", Code: 88}
+	if !reflect.DeepEqual(expected, apiError) {
+		t.Errorf("expected %v, got %v", expected, apiError)
+	}
+	if model != (FakeModel{}) {
+		t.Errorf("expected zero model, got %v", model)
+	}
+}
+
+func TestReceiveAs_noContent(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/foo", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	})
+
+	model, resp, err := ReceiveAs[*FakeModel, APIError](New().Client(client).Delete("http://example.com/foo"))
+	if err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if resp.StatusCode != 204 {
+		t.Errorf("expected %d, got %d", 204, resp.StatusCode)
+	}
+	if model != nil {
+		t.Errorf("expected nil model, got %v", model)
+	}
+}
+
+func TestReceiveAsContext_canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, resp, err := ReceiveAsContext[FakeModel, APIError](ctx, New().Post("http://example.com/").BodyJSON(modelA))
+	if err != context.Canceled {
+		t.Errorf("expected %v, got %v", context.Canceled, err)
+	}
+	if resp != nil {
+		t.Errorf("expected nil resp, got %v", resp)
+	}
+}
+
+func TestEndpoint_call(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/api/models", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.Method {
+		case "GET":
+			assertQuery(t, map[string]string{"kind_name": "recent", "count": "25"}, r)
+			fmt.Fprintf(w, `{"text": "listed"}`)
+		case "POST":
+			assertPostForm(t, map[string]string{"kind_name": "new", "count": "1"}, r)
+			fmt.Fprintf(w, `{"text": "created"}`)
+		case "PUT":
+			var model FakeModel
+			if err := (jsonDecoder{}).Decode(&http.Response{Body: r.Body}, &model); err != nil || model != modelA {
+				t.Errorf("expected JSON body %v, got %v, %v", modelA, model, err)
+			}
+			fmt.Fprintf(w, `{"text": "updated"}`)
+		}
+	})
+
+	api := New().Client(client).Base("http://example.com/api/")
+	list := Endpoint[FakeParams, FakeModel]{Path: "models"}
+	create := Endpoint[FakeParams, FakeModel]{Method: "POST", Path: "models", Encode: (*Nougat).BodyForm}
+	update := Endpoint[FakeModel, FakeModel]{Method: "PUT", Path: "models"}
+
+	cases := []struct {
+		call     func() (FakeModel, *http.Response, error)
+		expected string
+	}{
+		{func() (FakeModel, *http.Response, error) { return list.Call(context.Background(), api, paramsB) }, "listed"},
+		{func() (FakeModel, *http.Response, error) {
+			return create.Call(context.Background(), api, FakeParams{KindName: "new", Count: 1})
+		}, "created"},
+		{func() (FakeModel, *http.Response, error) { return update.Call(context.Background(), api, modelA) }, "updated"},
+	}
+	for _, c := range cases {
+		model, _, err := c.call()
+		if err != nil {
+			t.Errorf("expected nil, got %v", err)
+		}
+		if model.Text != c.expected {
+			t.Errorf("expected %s, got %s", c.expected, model.Text)
+		}
+	}
+	// calling endpoints must not modify the parent Nougat
+	if api.method != "GET" || api.rawURL != "http://example.com/api/" || api.bodyProvider != nil {
+		t.Errorf("parent Nougat was modified: %+v", api)
+	}
+}
+
+func TestEndpoint_failure(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+
+	missing := Endpoint[struct{}, FakeModel]{Path: "missing"}
+	_, resp, err := missing.Call(context.Background(), New().Client(client).Base("http://example.com/"), struct{}{})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != 404 {
+		t.Errorf("expected a 404 *HTTPError, got %v", err)
+	} else if httpErr.Failure != nil || len(httpErr.Body) == 0 {
+		t.Errorf("expected the failure body only in Body, got %v and %q", httpErr.Failure, httpErr.Body)
+	}
+	if resp.StatusCode != 404 {
+		t.Errorf("expected %d, got %d", 404, resp.StatusCode)
+	}
+}
+
+func TestEndpoint_pathTemplate(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/users/42/orders/7", func(w http.ResponseWriter, r *http.Request) {
+		// fields bound to the path aren't repeated in the query
+		if expected := "Ref=&Secret=s"; r.URL.RawQuery != expected {
+			t.Errorf("expected query %q, got %q", expected, r.URL.RawQuery)
+		}
+		fmt.Fprintf(w, `{"text": "order"}`)
+	})
+
+	getOrder := Endpoint[fakePathParams, FakeModel]{Path: "users/{id}/orders/{OrderID}"}
+	model, _, err := getOrder.Call(context.Background(), New().Client(client).Base("http://example.com/"), fakePathParams{UserID: "42", OrderID: 7, Secret: "s"})
+	if err != nil {
+		t.Errorf("expected nil, got %v", err)
+	}
+	if model.Text != "order" {
+		t.Errorf("expected %s, got %s", "order", model.Text)
+	}
+}
+
+func TestEndpoint_nonStructValue(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/tags", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, `{"text": %q}`, strings.TrimSpace(string(body)))
+	})
+
+	api := New().Client(client).Base("http://example.com/")
+	setTags := Endpoint[[]string, FakeModel]{Method: "POST", Path: "tags"}
+	model, _, err := setTags.Call(context.Background(), api, []string{"a", "b"})
+	if err != nil || model.Text != `["a","b"]` {
+		t.Errorf("expected %s, got %s and %v", `["a","b"]`, model.Text, err)
+	}
+	setLabels := Endpoint[map[string]int, FakeModel]{Method: "PUT", Path: "tags"}
+	model, _, err = setLabels.Call(context.Background(), api, map[string]int{"a": 1})
+	if err != nil || model.Text != `{"a":1}` {
+		t.Errorf("expected %s, got %s and %v", `{"a":1}`, model.Text, err)
+	}
+}
+
+func TestEndpoint_lowercaseMethod(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/models", func(w http.ResponseWriter, r *http.Request) {
+		assertMethod(t, "GET", r)
+		assertQuery(t, map[string]string{"kind_name": "recent", "count": "25"}, r)
+		if r.ContentLength != 0 {
+			t.Errorf("expected no body, got %d bytes", r.ContentLength)
+		}
+		fmt.Fprintf(w, `{"text": "listed"}`)
+	})
+
+	list := Endpoint[FakeParams, FakeModel]{Method: "get", Path: "models"}
+	model, _, err := list.Call(context.Background(), New().Client(client).Base("http://example.com/"), paramsB)
+	if err != nil || model.Text != "listed" {
+		t.Errorf("expected %s, got %s and %v", "listed", model.Text, err)
+	}
+}
+
+func TestEndpoint_nilPointer(t *testing.T) {
+	client, mux, server := testServer()
+	defer server.Close()
+	mux.HandleFunc("/models", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, `{"text": %q}`, string(body))
+	})
+
+	create := Endpoint[*FakeModel, FakeModel]{Method: "POST", Path: "models"}
+	model, _, err := create.Call(context.Background(), New().Client(client).Base("http://example.com/"), nil)
+	if err != nil || model.Text != "" {
+		t.Errorf("expected an empty body, got %q and %v", model.Text, err)
+	}
+}
@@ -1,28 +1,79 @@
 package nougat
 
-import "net/url"
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-querystring/query"
+)
 
 // Base sets the rawURL.
 // If you intend to extend the url with Path, baseUrl should be specified
 // with a trailing slash.
+// If parsing errors occur, the error is recorded (see Err()).
 func (r *Nougat) Base(rawURL string) *Nougat {
 	r.rawURL = rawURL
+	r.placeholders = nil
+	if _, err := url.Parse(rawURL); err != nil {
+		r.setErr("Base", err)
+		return r
+	}
+	r.addPlaceholders(rawURL)
 	return r
 }
 
 // Path extends the rawURL with the given path by resolving the reference
-// to an absolute URL.
-// If parsing errors occur, the rawURL is left unmodified.
+// to an absolute URL. The path may be a template with "{name}" placeholders,
+// such as "users/{id}/orders/{orderID}", whose values are set with PathParam
+// or PathStruct.
+// If parsing errors occur, the rawURL is left unmodified and the error is
+// recorded (see Err()).
 func (r *Nougat) Path(path string) *Nougat {
-	baseURL, baseErr := url.Parse(r.rawURL)
-	pathURL, pathErr := url.Parse(path)
-	if baseErr == nil && pathErr == nil {
-		r.rawURL = baseURL.ResolveReference(pathURL).String()
+	return r.path("Path", path)
+}
+
+// path implements Path, recording errors for the named setter.
+func (r *Nougat) path(setter, path string) *Nougat {
+	baseURL, err := url.Parse(r.rawURL)
+	if err != nil {
+		r.setErr(setter, err)
+		return r
+	}
+	pathURL, err := url.Parse(path)
+	if err != nil {
+		r.setErr(setter, err)
 		return r
 	}
+	r.rawURL = baseURL.ResolveReference(pathURL).String()
+	r.addPlaceholders(path)
 	return r
 }
 
+// addPlaceholders records the names of the "{name}" placeholders written in
+// template, so that only those are expanded.
+func (r *Nougat) addPlaceholders(template string) {
+	for _, m := range templatePlaceholder.FindAllStringSubmatch(template, -1) {
+		if !r.isPlaceholder(m[1]) {
+			r.placeholders = append(r.placeholders, m[1])
+		}
+	}
+}
+
+// isPlaceholder reports whether name was written as a placeholder in a
+// template passed to Base or Path.
+func (r *Nougat) isPlaceholder(name string) bool {
+	for _, placeholder := range r.placeholders {
+		if placeholder == name {
+			return true
+		}
+	}
+	return false
+}
+
 // QueryStruct appends the queryStruct to the Nougat's queryStructs.
 // The value pointed to by each queryStruct will be encoded as url query
 // parameters on new requests (see Request()).
@@ -34,3 +85,237 @@ func (r *Nougat) QueryStruct(queryStruct interface{}) *Nougat {
 	}
 	return r
 }
+
+// PathParam sets the value of the named placeholder in path templates, such
+// as "{id}" in Path("users/{id}"). The value is escaped as a single path
+// segment, so values containing '/' or spaces are safe.
+// Placeholders are replaced on new requests (see Request()), which return
+// an error for placeholders without a value.
+func (r *Nougat) PathParam(name, value string) *Nougat {
+	if r.pathParams == nil {
+		r.pathParams = make(map[string]string)
+	}
+	r.pathParams[name] = value
+	return r
+}
+
+// PathStruct appends the pathStruct to the Nougat's pathStructs. The fields
+// of each pathStruct provide values for path template placeholders, named by
+// the field's `path` tag or, without a tag, by the field name. Fields tagged
+// `path:"-"` are skipped. Values set with PathParam take precedence.
+// The pathStruct argument should be a struct or a pointer to a struct,
+// otherwise an error is recorded (see Err()).
+func (r *Nougat) PathStruct(pathStruct interface{}) *Nougat {
+	if pathStruct == nil {
+		return r
+	}
+	if kind := reflect.Indirect(reflect.ValueOf(pathStruct)).Kind(); kind != reflect.Struct && kind != reflect.Invalid {
+		r.setErr("PathStruct", fmt.Errorf("expected a struct, got %T", pathStruct))
+		return r
+	}
+	r.pathStructs = append(r.pathStructs, pathStruct)
+	return r
+}
+
+// pathPlaceholder matches "{name}" placeholders, also when escaped by Path.
+var pathPlaceholder = regexp.MustCompile(`(?:\{|%7[Bb])([A-Za-z_][A-Za-z0-9_.\-]*)(?:\}|%7[Dd])`)
+
+// templatePlaceholder matches the "{name}" placeholders of a template.
+var templatePlaceholder = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_.\-]*)\}`)
+
+// routeTemplateKey is the context key of a request's route template.
+type routeTemplateKey struct{}
+
+// RouteTemplate returns the unexpanded path template of a request built by
+// a Nougat with path parameters, such as "/users/{id}", so that middleware
+// can group requests by route. ok is false for other requests.
+func RouteTemplate(req *http.Request) (template string, ok bool) {
+	template, ok = req.Context().Value(routeTemplateKey{}).(string)
+	return template, ok
+}
+
+// routeTemplate returns the path of rawURL with its placeholders unescaped,
+// if it has any.
+func (r *Nougat) routeTemplate(rawURL string) (string, bool) {
+	end := strings.IndexAny(rawURL, "?#")
+	if end < 0 {
+		end = len(rawURL)
+	}
+	var found bool
+	path := pathPlaceholder.ReplaceAllStringFunc(rawURL[:end], func(placeholder string) string {
+		name := pathPlaceholder.FindStringSubmatch(placeholder)[1]
+		if !r.isPlaceholder(name) {
+			return placeholder
+		}
+		found = true
+		return "{" + name + "}"
+	})
+	if !found {
+		return "", false
+	}
+	u, err := url.Parse(path)
+	if err != nil {
+		return "", false
+	}
+	return u.Path, true
+}
+
+// expandPath replaces the placeholders in the path of rawURL with the
+// escaped values of the Nougat's path parameters. Placeholders which weren't
+// written in a template passed to Base or Path, such as an escaped "{" in
+// an existing path, are left as they are.
+func (r *Nougat) expandPath(rawURL string) (string, error) {
+	end := strings.IndexAny(rawURL, "?#")
+	if end < 0 {
+		end = len(rawURL)
+	}
+	path := rawURL[:end]
+	if len(r.placeholders) == 0 || !pathPlaceholder.MatchString(path) {
+		return rawURL, nil
+	}
+	params, err := r.pathValues()
+	if err != nil {
+		return "", err
+	}
+
+	var missing, invalid string
+	expanded := pathPlaceholder.ReplaceAllStringFunc(path, func(placeholder string) string {
+		name := pathPlaceholder.FindStringSubmatch(placeholder)[1]
+		if !r.isPlaceholder(name) {
+			return placeholder
+		}
+		value, ok := params[name]
+		if !ok {
+			if missing == "" {
+				missing = name
+			}
+			return placeholder
+		}
+		// escaping leaves these as they are, which would change the path
+		if value == "" || value == "." || value == ".." {
+			if invalid == "" {
+				invalid = name
+			}
+			return placeholder
+		}
+		return url.PathEscape(value)
+	})
+	if missing != "" {
+		return "", fmt.Errorf("nougat: missing value for path parameter %q", missing)
+	}
+	if invalid != "" {
+		return "", fmt.Errorf("nougat: invalid value %q for path parameter %q", params[invalid], invalid)
+	}
+	return expanded + rawURL[end:], nil
+}
+
+// pathValues returns the path parameter values of the pathStructs and
+// pathParams, later values taking precedence.
+func (r *Nougat) pathValues() (map[string]string, error) {
+	params := make(map[string]string)
+	for _, pathStruct := range r.pathStructs {
+		if err := addPathStruct(params, pathStruct); err != nil {
+			return nil, err
+		}
+	}
+	for name, value := range r.pathParams {
+		params[name] = value
+	}
+	return params, nil
+}
+
+// addPathStruct adds the values of the exported fields of the pathStruct
+// to params.
+func addPathStruct(params map[string]string, pathStruct interface{}) error {
+	v := reflect.ValueOf(pathStruct)
+	for v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("nougat: PathStruct expects a struct, got %T", pathStruct)
+	}
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			// unexported
+			continue
+		}
+		name := field.Tag.Get("path")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		value := v.Field(i)
+		if value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		}
+		params[name] = fmt.Sprint(value.Interface())
+	}
+	return nil
+}
+
+// queryWithoutPathFields adds the url query parameters of the queryStruct
+// to the rawURL like QueryStruct, but without the fields bound to
+// placeholders in path, so values in the path aren't repeated in the query.
+func (r *Nougat) queryWithoutPathFields(queryStruct interface{}, path string) *Nougat {
+	v := reflect.Indirect(reflect.ValueOf(queryStruct))
+	if v.Kind() != reflect.Struct {
+		return r.QueryStruct(queryStruct)
+	}
+	placeholders := make(map[string]bool)
+	for _, match := range pathPlaceholder.FindAllStringSubmatch(path, -1) {
+		placeholders[match[1]] = true
+	}
+	var bound []string
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("path")
+		if name == "" {
+			name = field.Name
+		}
+		if field.PkgPath != "" || !placeholders[name] {
+			continue
+		}
+		// named like go-querystring names query parameters
+		key, _ := splitPair(field.Tag.Get("url"), ",")
+		if key == "" {
+			key = field.Name
+		}
+		bound = append(bound, key)
+	}
+	if len(bound) == 0 {
+		return r.QueryStruct(queryStruct)
+	}
+	values, err := query.Values(queryStruct)
+	if err != nil {
+		r.setErr("QueryStruct", err)
+		return r
+	}
+	for _, key := range bound {
+		values.Del(key)
+	}
+	reqURL, err := url.Parse(r.rawURL)
+	if err != nil {
+		r.setErr("QueryStruct", err)
+		return r
+	}
+	urlValues := reqURL.Query()
+	for key, vals := range values {
+		for _, value := range vals {
+			urlValues.Add(key, value)
+		}
+	}
+	reqURL.RawQuery = urlValues.Encode()
+	r.rawURL = reqURL.String()
+	return r
+}
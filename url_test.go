@@ -73,3 +73,107 @@ func TestQueryStructSetter(t *testing.T) {
 		}
 	}
 }
+
+type fakePathParams struct {
+	UserID  string `path:"id"`
+	OrderID int
+	Secret  string `path:"-"`
+	Ref     *string
+	hidden  string
+}
+
+func TestRequest_pathTemplates(t *testing.T) {
+	ref := "r 1"
+	cases := []struct {
+		Nougat      *Nougat
+		expectedURL string
+	}{
+		{New().Base("http://a.io/").Path("users/{id}").PathParam("id", "42"), "http://a.io/users/42"},
+		{New().Base("http://a.io/users/{id}/").PathParam("id", "42").Path("orders/{orderID}").PathParam("orderID", "7"), "http://a.io/users/42/orders/7"},
+		// values are escaped as a single path segment
+		{New().Get("http://a.io/files/{name}").PathParam("name", "a/b c.txt"), "http://a.io/files/a%2Fb%20c.txt"},
+		{New().Get("http://a.io/users/{id}?q={id}").PathParam("id", "42"), "http://a.io/users/42?q=%7Bid%7D"},
+		// PathStruct values
+		{New().Get("http://a.io/users/{id}/orders/{OrderID}").PathStruct(fakePathParams{UserID: "42", OrderID: 7}), "http://a.io/users/42/orders/7"},
+		{New().Get("http://a.io/{Ref}").PathStruct(&fakePathParams{Ref: &ref}), "http://a.io/r%201"},
+		// PathParam takes precedence over PathStruct
+		{New().Get("http://a.io/users/{id}").PathParam("id", "1").PathStruct(fakePathParams{UserID: "2"}), "http://a.io/users/1"},
+		// children inherit path parameters
+		{New().Get("http://a.io/users/{id}").PathParam("id", "42").New(), "http://a.io/users/42"},
+		// queries are kept
+		{New().Get("http://a.io/users/{id}").PathParam("id", "42").QueryStruct(paramsA), "http://a.io/users/42?limit=30"},
+		// escaped braces of an existing path aren't placeholders
+		{New().Get("http://a.io/%7Bliteral%7D/users"), "http://a.io/%7Bliteral%7D/users"},
+		{New().Base("http://a.io/%7Bliteral%7D/").Path("users/{id}").PathParam("id", "42"), "http://a.io/%7Bliteral%7D/users/42"},
+	}
+	for _, c := range cases {
+		req, err := c.Nougat.Request()
+		if err != nil {
+			t.Errorf("expected nil, got %v", err)
+			continue
+		}
+		if req.URL.String() != c.expectedURL {
+			t.Errorf("expected url %s, got %s", c.expectedURL, req.URL.String())
+		}
+	}
+}
+
+func TestRequest_pathTemplateErrors(t *testing.T) {
+	cases := []struct {
+		Nougat      *Nougat
+		expectedErr string
+	}{
+		{New().Get("http://a.io/users/{id}"), `nougat: missing value for path parameter "id"`},
+		{New().Get("http://a.io/users/{id}/orders/{orderID}").PathParam("id", "1"), `nougat: missing value for path parameter "orderID"`},
+		{New().Get("http://a.io/{Secret}").PathStruct(fakePathParams{Secret: "x"}), `nougat: missing value for path parameter "Secret"`},
+		{New().Get("http://a.io/{id}").PathStruct("id"), "nougat: PathStruct: expected a struct, got string"},
+		// values which would change the path are rejected
+		{New().Get("http://a.io/users/{id}/orders").PathParam("id", ".."), `nougat: invalid value ".." for path parameter "id"`},
+		{New().Get("http://a.io/users/{id}/orders").PathParam("id", "."), `nougat: invalid value "." for path parameter "id"`},
+		{New().Get("http://a.io/users/{id}/orders").PathParam("id", ""), `nougat: invalid value "" for path parameter "id"`},
+	}
+	for _, c := range cases {
+		req, err := c.Nougat.Request()
+		if err == nil || err.Error() != c.expectedErr {
+			t.Errorf("expected error %s, got %v", c.expectedErr, err)
+		}
+		if req != nil {
+			t.Errorf("expected nil Request, got %+v", req)
+		}
+	}
+}
+
+func TestPathParamSetter(t *testing.T) {
+	parent := New().PathParam("id", "1")
+	child := parent.New().PathParam("id", "2").PathParam("name", "x")
+	if parent.pathParams["id"] != "1" || len(parent.pathParams) != 1 {
+		t.Errorf("child PathParam modified the parent, got %v", parent.pathParams)
+	}
+	if child.pathParams["id"] != "2" || child.pathParams["name"] != "x" {
+		t.Errorf("expected child params, got %v", child.pathParams)
+	}
+}
+
+func TestRouteTemplate(t *testing.T) {
+	cases := []struct {
+		Nougat           *Nougat
+		expectedTemplate string
+		expectedOK       bool
+	}{
+		{New().Get("http://a.io/users/{id}").PathParam("id", "42"), "/users/{id}", true},
+		{New().Base("http://a.io/users/{id}/").Path("orders/{orderID}?page={page}").PathParam("id", "1").PathParam("orderID", "2"), "/users/{id}/orders/{orderID}", true},
+		{New().Get("http://a.io/users/42"), "", false},
+		{New().Get("http://a.io/%7Bliteral%7D/users"), "", false},
+	}
+	for _, c := range cases {
+		req, err := c.Nougat.Request()
+		if err != nil {
+			t.Errorf("expected nil, got %v", err)
+			continue
+		}
+		template, ok := RouteTemplate(req)
+		if template != c.expectedTemplate || ok != c.expectedOK {
+			t.Errorf("expected %s %t, got %s %t", c.expectedTemplate, c.expectedOK, template, ok)
+		}
+	}
+}